@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/transaction/chaintracker/headers_client"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+	"github.com/bsvhackathon/GorillaPool/backend/storage"
+	"github.com/bsvhackathon/GorillaPool/backend/txstore"
+	"github.com/redis/go-redis/v9"
+)
+
+// App holds the connections and services commands are built from.
+type App struct {
+	Config       *Config
+	Redis        *redis.Client
+	Storage      *storage.RedisStorage
+	Roots        []*opns.Root
+	ChainTracker headers_client.Client
+	lookups      map[string]*opns.LookupService
+	store        *txstore.Store
+}
+
+func New(cfg *Config) (*App, error) {
+	a := &App{
+		Config: cfg,
+		ChainTracker: headers_client.Client{
+			Url:    cfg.BlockHeadersURL,
+			ApiKey: cfg.BlockHeadersAPIKey,
+		},
+		lookups: map[string]*opns.LookupService{},
+	}
+	if opts, err := redis.ParseURL(cfg.Redis); err != nil {
+		return nil, err
+	} else {
+		a.Redis = redis.NewClient(opts)
+	}
+	var err error
+	if a.Storage, err = storage.NewRedisStorage(cfg.Redis); err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	} else if a.Roots, err = opns.LoadRoots(cfg.Roots); err != nil {
+		return nil, fmt.Errorf("roots: %w", err)
+	}
+	return a, nil
+}
+
+// LookupService returns the lookup service of root, creating it on first use.
+func (a *App) LookupService(root *opns.Root) (*opns.LookupService, error) {
+	if ls, ok := a.lookups[root.Service]; ok {
+		return ls, nil
+	} else if ls, err := opns.NewLookupService(a.Config.Redis, a.Storage, root, &a.ChainTracker); err != nil {
+		return nil, err
+	} else if err := ls.MigrateSpent(context.Background()); err != nil {
+		ls.Close()
+		return nil, fmt.Errorf("migrating spends: %w", err)
+	} else if remote, err := a.Remote(); err != nil {
+		ls.Close()
+		return nil, err
+	} else {
+		// Reorgs are settled against the remote, as the store may hold
+		// proofs from the orphaned chain.
+		ls.SetChain(remote)
+		a.lookups[root.Service] = ls
+		return ls, nil
+	}
+}
+
+// Engine returns an engine with the topic manager and lookup service of
+// every root registered.
+func (a *App) Engine() (*engine.Engine, error) {
+	e := &engine.Engine{
+		Managers:       make(map[string]engine.TopicManager, len(a.Roots)),
+		LookupServices: make(map[string]engine.LookupService, len(a.Roots)),
+		Storage:        a.Storage,
+		ChainTracker:   a.ChainTracker,
+		HostingURL:     a.Config.HostingURL,
+	}
+	for _, root := range a.Roots {
+		if ls, err := a.LookupService(root); err != nil {
+			return nil, fmt.Errorf("lookup service %s: %w", root.Service, err)
+		} else {
+			e.Managers[root.Topic] = checked(opns.NewTopicManager(root))
+			e.LookupServices[root.Service] = ls
+		}
+	}
+	return e, nil
+}
+
+// Topics lists the topic of every root.
+func (a *App) Topics() []string {
+	topics := make([]string, 0, len(a.Roots))
+	for _, root := range a.Roots {
+		topics = append(topics, root.Topic)
+	}
+	return topics
+}
+
+// Source returns the transaction store, reading through to the configured
+// ingest source.
+func (a *App) Source() (*txstore.Store, error) {
+	if a.store != nil {
+		return a.store, nil
+	} else if remote, err := a.Remote(); err != nil {
+		return nil, err
+	} else if a.store, err = txstore.Open(a.Config.TxStore, remote); err != nil {
+		return nil, fmt.Errorf("txstore: %w", err)
+	}
+	return a.store, nil
+}
+
+// Remote returns the configured ingest source itself.
+func (a *App) Remote() (ingest.Source, error) {
+	if src, err := ingest.New(a.Config.IngestSource); err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	} else {
+		return src, nil
+	}
+}
+
+func (a *App) Close() error {
+	for _, ls := range a.lookups {
+		ls.Close()
+	}
+	if a.store != nil {
+		a.store.Close()
+	}
+	a.Storage.Close()
+	return a.Redis.Close()
+}
+
+// SignalContext is canceled on SIGINT or SIGTERM.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config is the settings shared by every command. Values come from, in
+// increasing priority, the env file, the environment, and flags.
+type Config struct {
+	// EnvFile is the env file loaded, empty if none was found.
+	EnvFile             string
+	Redis               string
+	JungleBus           string
+	IngestSource        string
+	TxStore             string
+	Roots               string
+	BlockHeadersURL     string
+	BlockHeadersAPIKey  string
+	HostingURL          string
+	Peers               []string
+	Port                int
+	PaymailDomain       string
+	StripeSecretKey     string
+	StripeWebhookSecret string
+	// MaxBeefSize is the largest BEEF, in bytes, accepted by /submit.
+	MaxBeefSize int
+	// AdminToken is the bearer token for the admin API, which is disabled
+	// when it is empty.
+	AdminToken string
+}
+
+// findEnvFile looks for .env in the working directory and each parent, so
+// commands can be run from anywhere in the checkout.
+func findEnvFile() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ".env")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig parses the global flags in args, loading the env file named by
+// -env or OPNS_ENV, or else the nearest .env. A named file that cannot be
+// read is an error. It returns the arguments left after the flags.
+func LoadConfig(args []string) (*Config, []string, error) {
+	// The env file supplies flag defaults, so it is found before parsing.
+	envFile := envFileArg(args)
+	if envFile == "" {
+		envFile = os.Getenv("OPNS_ENV")
+	}
+	if envFile != "" {
+		if err := godotenv.Load(envFile); err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", envFile, err)
+		}
+	} else if envFile = findEnvFile(); envFile != "" {
+		if err := godotenv.Load(envFile); err != nil {
+			return nil, nil, fmt.Errorf("loading %s: %w", envFile, err)
+		}
+	}
+
+	cfg := &Config{EnvFile: envFile}
+	fs, peers := configFlags(cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if *peers != "" {
+		cfg.Peers = strings.Split(*peers, ",")
+	}
+	if cfg.IngestSource == "" {
+		cfg.IngestSource = "junglebus:" + cfg.JungleBus
+	}
+	// Packages that read the environment directly see flag overrides too.
+	os.Setenv("HOSTING_URL", cfg.HostingURL)
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// configFlags defines the global flags, with defaults from the environment,
+// writing into cfg. It returns the flag set and the -peers value.
+func configFlags(cfg *Config) (*flag.FlagSet, *string) {
+	maxBeefSize, _ := strconv.Atoi(os.Getenv("MAX_BEEF_SIZE"))
+	if maxBeefSize == 0 {
+		maxBeefSize = 32 << 20
+	}
+	port, _ := strconv.Atoi(os.Getenv("PORT"))
+	if port == 0 {
+		port = 3000
+	}
+	fs := flag.NewFlagSet("opns", flag.ContinueOnError)
+	fs.String("env", cfg.EnvFile, "Env file to load (default: OPNS_ENV or the nearest .env)")
+	fs.StringVar(&cfg.Redis, "redis", os.Getenv("REDIS"), "Redis URL")
+	fs.StringVar(&cfg.JungleBus, "junglebus", envOr("JUNGLEBUS", "https://texas1.junglebus.gorillapool.io"), "JungleBus URL")
+	fs.StringVar(&cfg.IngestSource, "source", os.Getenv("INGEST_SOURCE"), "Ingest source, junglebus:<url>, rest:<url> or file:<dir> (default: junglebus:<junglebus>)")
+	fs.StringVar(&cfg.TxStore, "txstore", os.Getenv("TXSTORE"), "Transaction store, fs:<dir> or sqlite:<path>")
+	fs.StringVar(&cfg.Roots, "roots", os.Getenv("OPNS_ROOTS"), "JSON file of additional name roots")
+	fs.StringVar(&cfg.BlockHeadersURL, "headers", os.Getenv("BLOCK_HEADERS_URL"), "Block headers service URL")
+	fs.StringVar(&cfg.BlockHeadersAPIKey, "headers-key", os.Getenv("BLOCK_HEADERS_API_KEY"), "Block headers service API key")
+	fs.StringVar(&cfg.HostingURL, "hosting-url", os.Getenv("HOSTING_URL"), "Public URL of this overlay")
+	peers := fs.String("peers", os.Getenv("PEERS"), "Comma separated overlay peers")
+	fs.IntVar(&cfg.Port, "p", port, "Port to listen on")
+	fs.IntVar(&cfg.MaxBeefSize, "max-beef", maxBeefSize, "Largest BEEF in bytes accepted by /submit")
+	fs.StringVar(&cfg.AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "Bearer token for the admin API (default: disabled)")
+	fs.StringVar(&cfg.PaymailDomain, "paymail-domain", os.Getenv("PAYMAIL_DOMAIN"), "Paymail domain")
+	cfg.StripeSecretKey = os.Getenv("STRIPE_SECRET_KEY")
+	cfg.StripeWebhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: opns [flags] <command> [command flags]")
+		fmt.Fprintln(fs.Output(), "\nCommands:")
+		fmt.Fprintln(fs.Output(), "  serve, subscribe, ingest, process, spends, prefetch, admin")
+		fmt.Fprintln(fs.Output(), "\nFlags:")
+		fs.PrintDefaults()
+	}
+	return fs, peers
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Validate reports every setting that is missing or malformed.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Redis == "" {
+		errs = append(errs, errors.New("redis: REDIS is not set"))
+	} else if _, err := redis.ParseURL(c.Redis); err != nil {
+		errs = append(errs, fmt.Errorf("redis: %w", err))
+	}
+	if kind, _, ok := strings.Cut(c.IngestSource, ":"); !ok || (kind != "junglebus" && kind != "rest" && kind != "file") {
+		errs = append(errs, fmt.Errorf("source: invalid %q", c.IngestSource))
+	}
+	if c.TxStore != "" {
+		if kind, _, ok := strings.Cut(c.TxStore, ":"); !ok || (kind != "fs" && kind != "sqlite") {
+			errs = append(errs, fmt.Errorf("txstore: invalid %q", c.TxStore))
+		}
+	}
+	if c.Roots != "" {
+		if _, err := os.Stat(c.Roots); err != nil {
+			errs = append(errs, fmt.Errorf("roots: %w", err))
+		}
+	}
+	for _, peer := range c.Peers {
+		if u, err := url.Parse(peer); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("peers: invalid URL %q", peer))
+		}
+	}
+	if c.MaxBeefSize < 1 {
+		errs = append(errs, fmt.Errorf("max-beef: %d must be positive", c.MaxBeefSize))
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d out of range", c.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// envFileArg returns the value of -env among the global flags in args. The
+// flags are parsed in full, so the value of another flag is never mistaken
+// for the end of the flags.
+func envFileArg(args []string) string {
+	fs, _ := configFlags(&Config{})
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	fs.Parse(args)
+	return fs.Lookup("env").Value.String()
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvFileArg(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-env", "prod.env", "serve"}, "prod.env"},
+		{[]string{"-env=prod.env", "serve"}, "prod.env"},
+		{[]string{"--env=prod.env", "serve"}, "prod.env"},
+		{[]string{"-redis", "redis://x", "-env", "prod.env", "serve"}, "prod.env"},
+		{[]string{"-redis", "redis://x", "-env=prod.env", "serve"}, "prod.env"},
+		{[]string{"-redis=redis://x", "-p", "3001", "-env", "prod.env", "serve"}, "prod.env"},
+		{[]string{"-redis", "redis://x", "serve", "-env", "cmd.env"}, ""},
+		{[]string{"serve", "-env", "cmd.env"}, ""},
+		{[]string{"-redis", "redis://x"}, ""},
+		{nil, ""},
+	} {
+		if got := envFileArg(tt.args); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigEnvAfterValuedFlag(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "prod.env")
+	if err := os.WriteFile(envFile, []byte("PORT=3123\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The env file does not override variables already set.
+	t.Setenv("OPNS_ENV", "")
+	t.Setenv("HOSTING_URL", "")
+	t.Setenv("PORT", "")
+	os.Unsetenv("PORT")
+	cfg, args, err := LoadConfig([]string{"-redis", "redis://localhost:6379", "-env", envFile, "serve", "-s"})
+	if err != nil {
+		t.Fatal(err)
+	} else if cfg.EnvFile != envFile {
+		t.Errorf("loaded %q, want %q", cfg.EnvFile, envFile)
+	} else if cfg.Port != 3123 {
+		t.Errorf("port %d, want 3123 from the env file", cfg.Port)
+	} else if len(args) != 2 || args[0] != "serve" {
+		t.Errorf("args %q, want serve -s", args)
+	}
+}
@@ -0,0 +1,334 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/4chain-ag/go-overlay-services/pkg/core/gasp/core"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/redis/go-redis/v9"
+)
+
+// SyncStateKey is the hash of GASP sync state, "<topic> <peer>" to JSON
+// PeerSyncState.
+var SyncStateKey = "sync:state"
+
+// SyncRejectedKey is the set of outpoints peer offered for topic that GASP
+// did not admit. They are not synced again until the next full sync.
+func SyncRejectedKey(topic, peer string) string {
+	return "sync:rejected:" + topic + " " + peer
+}
+
+// shipPeer stands in for the peers a SHIP topic resolves when it syncs.
+const shipPeer = "ship"
+
+// reorgDepth is how far behind the outputs a peer offered its sync cursor
+// is kept, so outputs moved by a reorg are offered again.
+const reorgDepth = 6
+
+// PeerSyncState is the outcome of syncing one topic with one peer.
+type PeerSyncState struct {
+	Topic string `json:"topic"`
+	Peer  string `json:"peer"`
+	// Healthy is whether the last sync succeeded.
+	Healthy     bool  `json:"healthy"`
+	LastAttempt int64 `json:"lastAttempt,omitempty"`
+	LastSync    int64 `json:"lastSync,omitempty"`
+	// Since is the block height the next sync asks the peer for outputs
+	// from, following the outputs it has offered.
+	Since uint32 `json:"since"`
+	// LastFullSync is when the peer was last asked for all its outputs.
+	LastFullSync int64  `json:"lastFullSync,omitempty"`
+	Failures     int    `json:"failures"`
+	LastError    string `json:"lastError,omitempty"`
+	NextAttempt  int64  `json:"nextAttempt,omitempty"`
+}
+
+// Syncer runs GASP sync of every synced topic with each of its peers on a
+// schedule, keeping a state per topic and peer. A peer is asked first for
+// what changed since the last sync, and the full GASP exchange is only run
+// when it offers outputs not held here and not already refused, or every
+// FullInterval regardless. Failing peers are retried with backoff.
+type Syncer struct {
+	Topics *TopicRegistry
+	// Interval is the time between syncs; zero syncs once.
+	Interval time.Duration
+	// FullInterval is the time between full syncs with a peer; zero makes
+	// every sync full.
+	FullInterval time.Duration
+	Client       *http.Client
+}
+
+func NewSyncer(r *TopicRegistry, interval time.Duration) *Syncer {
+	return &Syncer{
+		Topics:       r,
+		Interval:     interval,
+		FullInterval: 24 * time.Hour,
+		Client:       &http.Client{Timeout: time.Minute},
+	}
+}
+
+type syncTarget struct {
+	topic  string
+	peer   string
+	engine *engine.Engine
+}
+
+// syncTargets lists each topic and peer to sync, with an engine limited to
+// that pair. The engines hold copies of the registry's maps so they can be
+// used without the lock.
+func (r *TopicRegistry) syncTargets() []*syncTarget {
+	r.RLock()
+	defer r.RUnlock()
+	managers := make(map[string]engine.TopicManager, len(r.Engine.Managers))
+	for topic, manager := range r.Engine.Managers {
+		managers[topic] = manager
+	}
+	services := make(map[string]engine.LookupService, len(r.Engine.LookupServices))
+	for service, ls := range r.Engine.LookupServices {
+		services[service] = ls
+	}
+	scoped := func(topic string, cfg engine.SyncConfiguration) *engine.Engine {
+		return &engine.Engine{
+			Managers:          managers,
+			LookupServices:    services,
+			Storage:           r.Engine.Storage,
+			ChainTracker:      r.Engine.ChainTracker,
+			HostingURL:        r.Engine.HostingURL,
+			Broadcaster:       r.Engine.Broadcaster,
+			SyncConfiguration: map[string]engine.SyncConfiguration{topic: cfg},
+		}
+	}
+
+	var targets []*syncTarget
+	for topic, cfg := range r.Engine.SyncConfiguration {
+		switch cfg.Type {
+		case engine.SyncConfigurationPeers:
+			for _, peer := range cfg.Peers {
+				if peer == r.Engine.HostingURL {
+					continue
+				}
+				targets = append(targets, &syncTarget{topic, peer, scoped(topic, engine.SyncConfiguration{
+					Type:        engine.SyncConfigurationPeers,
+					Peers:       []string{peer},
+					Concurrency: cfg.Concurrency,
+				})})
+			}
+		case engine.SyncConfigurationSHIP:
+			targets = append(targets, &syncTarget{topic, shipPeer, scoped(topic, cfg)})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].topic != targets[j].topic {
+			return targets[i].topic < targets[j].topic
+		}
+		return targets[i].peer < targets[j].peer
+	})
+	return targets
+}
+
+// Run syncs now and then every Interval until ctx is done.
+func (s *Syncer) Run(ctx context.Context) error {
+	for {
+		if err := s.SyncAll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Sync incomplete: %v", err)
+		}
+		if s.Interval <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.Interval):
+		}
+	}
+}
+
+// SyncAll syncs every topic with every peer that is due, returning the
+// failures.
+func (s *Syncer) SyncAll(ctx context.Context) error {
+	var errs []error
+	for _, target := range s.Topics.syncTargets() {
+		if ctx.Err() != nil {
+			break
+		} else if err := s.sync(ctx, target); err != nil {
+			errs = append(errs, fmt.Errorf("%s with %s: %w", target.topic, target.peer, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Syncer) sync(ctx context.Context, target *syncTarget) error {
+	state, err := s.state(ctx, target.topic, target.peer)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if now.Unix() < state.NextAttempt {
+		return nil
+	}
+	state.LastAttempt = now.Unix()
+
+	// A full sync asks the peer for all its outputs and runs GASP whatever
+	// it offers, catching outputs it learned of below the cursor.
+	full := now.Sub(time.Unix(state.LastFullSync, 0)) >= s.FullInterval
+	since := state.Since
+	if full {
+		since = 0
+		if err := s.Topics.app.Redis.Del(ctx, SyncRejectedKey(target.topic, target.peer)).Err(); err != nil {
+			return err
+		}
+	}
+	offered, changed, err := s.offered(ctx, target, since)
+	if err == nil && (changed || full) {
+		err = target.engine.StartGASPSync(ctx)
+	}
+	if err == nil {
+		since, err = s.cursor(ctx, target, since, offered)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		state.Healthy = false
+		state.Failures++
+		state.LastError = err.Error()
+		// Back off a failing peer, up to a day.
+		delay := time.Minute << min(state.Failures-1, 10)
+		state.NextAttempt = now.Add(min(delay, 24*time.Hour)).Unix()
+		log.Printf("Sync of %s with %s failed (%d in a row): %v", target.topic, target.peer, state.Failures, err)
+	} else {
+		state.Healthy = true
+		state.LastSync = now.Unix()
+		state.Since = since
+		if full {
+			state.LastFullSync = now.Unix()
+		}
+		state.Failures = 0
+		state.LastError = ""
+		state.NextAttempt = 0
+	}
+	if saveErr := s.save(ctx, state); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// offered asks the peer for the topic's outputs since a block and reports
+// whether any is neither held here nor refused before. SHIP topics have no
+// single peer to ask, so they are always synced.
+func (s *Syncer) offered(ctx context.Context, target *syncTarget, since uint32) ([]*overlay.Outpoint, bool, error) {
+	if target.peer == shipPeer {
+		return nil, true, nil
+	}
+	body, err := json.Marshal(&core.GASPInitialRequest{Version: 1, Since: since})
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.peer+"/requestSyncResponse", bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-BSV-Topic", target.topic)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("requestSyncResponse: %s", resp.Status)
+	}
+	var response core.GASPInitialResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, false, err
+	}
+	rejected := SyncRejectedKey(target.topic, target.peer)
+	for _, outpoint := range response.UTXOList {
+		if output, err := target.engine.Storage.FindOutput(ctx, outpoint, &target.topic, nil, false); err != nil {
+			return nil, false, err
+		} else if output != nil {
+			continue
+		} else if refused, err := s.Topics.app.Redis.SIsMember(ctx, rejected, outpoint.String()).Result(); err != nil {
+			return nil, false, err
+		} else if !refused {
+			return response.UTXOList, true, nil
+		}
+	}
+	return response.UTXOList, false, nil
+}
+
+// cursor is the height to ask the peer for outputs from next time: the
+// highest block holding one it offered, less a margin for reorgs. It is
+// called once GASP has attempted every offered output, so those still not
+// held were refused; they are recorded as rejected and skipped.
+func (s *Syncer) cursor(ctx context.Context, target *syncTarget, since uint32, offered []*overlay.Outpoint) (uint32, error) {
+	next := since
+	var rejected []any
+	for _, outpoint := range offered {
+		if output, err := target.engine.Storage.FindOutput(ctx, outpoint, &target.topic, nil, false); err != nil {
+			return 0, err
+		} else if output == nil {
+			rejected = append(rejected, outpoint.String())
+		} else if output.BlockHeight > reorgDepth {
+			next = max(next, output.BlockHeight-reorgDepth)
+		}
+	}
+	if len(rejected) > 0 {
+		if err := s.Topics.app.Redis.SAdd(ctx, SyncRejectedKey(target.topic, target.peer), rejected...).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return next, nil
+}
+
+func (s *Syncer) state(ctx context.Context, topic, peer string) (*PeerSyncState, error) {
+	state := &PeerSyncState{Topic: topic, Peer: peer}
+	if data, err := s.Topics.app.Redis.HGet(ctx, SyncStateKey, topic+" "+peer).Bytes(); err == redis.Nil {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *Syncer) save(ctx context.Context, state *PeerSyncState) error {
+	if data, err := json.Marshal(state); err != nil {
+		return err
+	} else {
+		return s.Topics.app.Redis.HSet(ctx, SyncStateKey, state.Topic+" "+state.Peer, data).Err()
+	}
+}
+
+// Status reports the sync state of every topic and peer synced so far.
+func (s *Syncer) Status(ctx context.Context) ([]*PeerSyncState, error) {
+	stored, err := s.Topics.app.Redis.HGetAll(ctx, SyncStateKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]*PeerSyncState, 0, len(stored))
+	for _, data := range stored {
+		state := &PeerSyncState{}
+		if err := json.Unmarshal([]byte(data), state); err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Topic != states[j].Topic {
+			return states[i].Topic < states[j].Topic
+		}
+		return states[i].Peer < states[j].Peer
+	})
+	return states, nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/4chain-ag/go-overlay-services/pkg/core/gasp/core"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+const syncTopic = "tm_sync"
+
+// syncPeer offers the outpoints it is given to requestSyncResponse.
+type syncPeer struct {
+	sync.Mutex
+	*httptest.Server
+	outpoints []*overlay.Outpoint
+}
+
+func (p *syncPeer) offer(outpoints ...*overlay.Outpoint) {
+	p.Lock()
+	defer p.Unlock()
+	p.outpoints = outpoints
+}
+
+// newSyncTarget returns a syncer and its target for syncTopic with a peer.
+func newSyncTarget(t *testing.T) (*Syncer, *syncTarget, *syncPeer) {
+	t.Helper()
+	peer := &syncPeer{}
+	peer.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer.Lock()
+		defer peer.Unlock()
+		json.NewEncoder(w).Encode(&core.GASPInitialResponse{UTXOList: peer.outpoints})
+	}))
+	t.Cleanup(peer.Close)
+	mr := miniredis.RunT(t)
+	a, err := New(&Config{Redis: "redis://" + mr.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	r := NewTopicRegistry(a, &engine.Engine{Storage: a.Storage})
+	return NewSyncer(r, 0), &syncTarget{syncTopic, peer.URL, r.Engine}, peer
+}
+
+// syncOutput returns an outpoint, stored at height when it is held.
+func syncOutput(t *testing.T, target *syncTarget, n byte, height uint32, held bool) *overlay.Outpoint {
+	t.Helper()
+	op := &overlay.Outpoint{Txid: chainhash.Hash{n}}
+	if held {
+		if err := target.engine.Storage.InsertOutput(context.Background(), &engine.Output{
+			Outpoint:    *op,
+			Topic:       syncTopic,
+			Script:      &script.Script{},
+			BlockHeight: height,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return op
+}
+
+func TestSyncSkipsRejected(t *testing.T) {
+	ctx := context.Background()
+	s, target, peer := newSyncTarget(t)
+	held := syncOutput(t, target, 1, 100, true)
+	refused := syncOutput(t, target, 2, 120, false)
+	peer.offer(held, refused)
+
+	if offered, changed, err := s.offered(ctx, target, 10); err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Fatal("an output not held was not reported")
+	} else if since, err := s.cursor(ctx, target, 10, offered); err != nil {
+		t.Fatal(err)
+	} else if since != 100-reorgDepth {
+		// GASP has attempted the output still missing, so it does not
+		// hold the cursor back.
+		t.Errorf("since %d, want %d", since, 100-reorgDepth)
+	}
+	if rejected, err := s.Topics.app.Redis.SMembers(ctx, SyncRejectedKey(syncTopic, peer.URL)).Result(); err != nil {
+		t.Fatal(err)
+	} else if len(rejected) != 1 || rejected[0] != refused.String() {
+		t.Errorf("rejected %v, want %s", rejected, refused)
+	}
+
+	// The refused output no longer calls for GASP, but a new one does.
+	if _, changed, err := s.offered(ctx, target, 94); err != nil {
+		t.Fatal(err)
+	} else if changed {
+		t.Error("a refused output was reported again")
+	}
+	peer.offer(held, refused, syncOutput(t, target, 3, 0, false))
+	if _, changed, err := s.offered(ctx, target, 94); err != nil {
+		t.Fatal(err)
+	} else if !changed {
+		t.Error("a new output was not reported")
+	}
+}
+
+func TestSyncFullRetriesRejected(t *testing.T) {
+	ctx := context.Background()
+	s, target, peer := newSyncTarget(t)
+	held := syncOutput(t, target, 1, 100, true)
+	refused := syncOutput(t, target, 2, 120, false)
+	peer.offer(held, refused)
+	if err := s.Topics.app.Redis.SAdd(ctx, SyncRejectedKey(syncTopic, peer.URL), refused.String(), "stale").Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first sync is full, so it forgets what was refused before and
+	// records what is refused now.
+	if err := s.sync(ctx, target); err != nil {
+		t.Fatal(err)
+	} else if rejected, err := s.Topics.app.Redis.SMembers(ctx, SyncRejectedKey(syncTopic, peer.URL)).Result(); err != nil {
+		t.Fatal(err)
+	} else if len(rejected) != 1 || rejected[0] != refused.String() {
+		t.Errorf("rejected %v, want %s", rejected, refused)
+	} else if state, err := s.state(ctx, syncTopic, peer.URL); err != nil {
+		t.Fatal(err)
+	} else if state.Since != 100-reorgDepth || state.LastFullSync == 0 {
+		t.Errorf("state %+v, want a full sync up to %d", state, 100-reorgDepth)
+	}
+}
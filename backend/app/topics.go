@@ -0,0 +1,367 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/b-open-io/bsv21-overlay/topics"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+	"github.com/redis/go-redis/v9"
+)
+
+// TopicConfigKey is the hash of topics added at runtime, topic to JSON
+// TopicConfig.
+var TopicConfigKey = "topics:config"
+
+// LegacyTopicsKey is the set of BSV-21 topics, "tm_<tokenId>", read before
+// topics were configurable.
+var LegacyTopicsKey = "topics"
+
+var (
+	ErrTopicExists   = errors.New("topic already registered")
+	ErrTopicNotFound = errors.New("topic not registered")
+	ErrTopicStatic   = errors.New("topic is configured by a name root")
+	ErrInvalidTopic  = errors.New("invalid topic")
+	// ErrTopicManager wraps the errors of topic managers, which refuse a
+	// transaction rather than fail to store it.
+	ErrTopicManager = errors.New("topic manager refused transaction")
+)
+
+// checkedManager wraps the errors of a topic manager in ErrTopicManager, so
+// callers of the engine can tell them apart from storage failures.
+type checkedManager struct {
+	engine.TopicManager
+}
+
+func checked(manager engine.TopicManager) engine.TopicManager {
+	return &checkedManager{manager}
+}
+
+func (m *checkedManager) IdentifyAdmissableOutputs(ctx context.Context, beef []byte, previousCoins []uint32) (overlay.AdmittanceInstructions, error) {
+	admit, err := m.TopicManager.IdentifyAdmissableOutputs(ctx, beef, previousCoins)
+	if err != nil {
+		return admit, fmt.Errorf("%w: %w", ErrTopicManager, err)
+	}
+	return admit, nil
+}
+
+func (m *checkedManager) IdentifyNeededInputs(ctx context.Context, beef []byte) ([]*overlay.Outpoint, error) {
+	inputs, err := m.TopicManager.IdentifyNeededInputs(ctx, beef)
+	if err != nil {
+		return inputs, fmt.Errorf("%w: %w", ErrTopicManager, err)
+	}
+	return inputs, nil
+}
+
+type TopicType string
+
+var (
+	TopicOpNS  TopicType = "opns"
+	TopicBSV21 TopicType = "bsv21"
+)
+
+// SyncConfig is how a topic is synchronized with other overlays. Type is
+// peers, ship or none.
+type SyncConfig struct {
+	Type        string   `json:"type"`
+	Peers       []string `json:"peers,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+}
+
+func (s *SyncConfig) engineConfig() (engine.SyncConfiguration, error) {
+	cfg := engine.SyncConfiguration{
+		Peers:       s.Peers,
+		Concurrency: s.Concurrency,
+	}
+	switch s.Type {
+	case "peers":
+		cfg.Type = engine.SyncConfigurationPeers
+	case "ship":
+		cfg.Type = engine.SyncConfigurationSHIP
+	case "none":
+		cfg.Type = engine.SyncConfigurationNone
+	default:
+		return cfg, fmt.Errorf("%w: unknown sync type %q", ErrInvalidTopic, s.Type)
+	}
+	return cfg, nil
+}
+
+// TopicConfig describes a topic manager. An OpNS topic is a name root; a
+// BSV-21 topic validates the listed tokens, by default the token in its
+// "tm_<tokenId>" name.
+type TopicConfig struct {
+	Topic    string           `json:"topic"`
+	Type     TopicType        `json:"type"`
+	TokenIDs []string         `json:"tokenIds,omitempty"`
+	Root     *opns.RootConfig `json:"root,omitempty"`
+	Sync     *SyncConfig      `json:"sync,omitempty"`
+}
+
+// TopicInfo is a registered topic as reported by the admin API.
+type TopicInfo struct {
+	*TopicConfig
+	Service        string            `json:"service,omitempty"`
+	Static         bool              `json:"static"`
+	MetaData       *overlay.MetaData `json:"metadata"`
+	LookupMetaData *overlay.MetaData `json:"lookupMetadata,omitempty"`
+}
+
+// TopicRegistry changes the engine's topic managers, lookup services and
+// sync configuration at runtime. Anything using the engine's maps must hold
+// the read lock.
+type TopicRegistry struct {
+	sync.RWMutex
+	Engine   *engine.Engine
+	app      *App
+	configs  map[string]*TopicConfig
+	services map[string]string
+	static   map[string]bool
+}
+
+func NewTopicRegistry(a *App, e *engine.Engine) *TopicRegistry {
+	if e.Managers == nil {
+		e.Managers = map[string]engine.TopicManager{}
+	}
+	if e.LookupServices == nil {
+		e.LookupServices = map[string]engine.LookupService{}
+	}
+	if e.SyncConfiguration == nil {
+		e.SyncConfiguration = map[string]engine.SyncConfiguration{}
+	}
+	return &TopicRegistry{
+		Engine:   e,
+		app:      a,
+		configs:  map[string]*TopicConfig{},
+		services: map[string]string{},
+		static:   map[string]bool{},
+	}
+}
+
+// Load registers the configured name roots, then the persisted topics and
+// any legacy BSV-21 topics.
+func (r *TopicRegistry) Load(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+	for _, root := range r.app.Roots {
+		if err := r.register(&TopicConfig{
+			Topic: root.Topic,
+			Type:  TopicOpNS,
+			Root:  root.Config(),
+		}); err != nil {
+			return err
+		}
+		r.static[root.Topic] = true
+	}
+
+	stored, err := r.app.Redis.HGetAll(ctx, TopicConfigKey).Result()
+	if err != nil {
+		return err
+	}
+	for topic, data := range stored {
+		cfg := &TopicConfig{}
+		if err := json.Unmarshal([]byte(data), cfg); err != nil {
+			return fmt.Errorf("topic %s: %w", topic, err)
+		} else if r.static[topic] {
+			// Only the sync configuration of a root can be changed.
+			r.configs[topic].Sync = cfg.Sync
+			if err := r.setSync(r.configs[topic]); err != nil {
+				return fmt.Errorf("topic %s: %w", topic, err)
+			}
+		} else if err := r.register(cfg); err != nil {
+			return fmt.Errorf("topic %s: %w", topic, err)
+		}
+	}
+
+	legacy, err := r.app.Redis.SMembers(ctx, LegacyTopicsKey).Result()
+	if err != nil {
+		return err
+	}
+	for _, topic := range legacy {
+		if _, ok := r.configs[topic]; ok {
+			continue
+		} else if err := r.register(&TopicConfig{Topic: topic, Type: TopicBSV21}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// register adds cfg to the engine. Callers hold the write lock.
+func (r *TopicRegistry) register(cfg *TopicConfig) error {
+	if cfg.Topic == "" {
+		return fmt.Errorf("%w: missing topic", ErrInvalidTopic)
+	} else if _, ok := r.configs[cfg.Topic]; ok {
+		return ErrTopicExists
+	}
+	// Checked first, as nothing created below is undone on failure.
+	syncConfig, err := r.syncConfig(cfg)
+	if err != nil {
+		return err
+	}
+	var manager engine.TopicManager
+	var service string
+	switch cfg.Type {
+	case TopicOpNS:
+		if cfg.Root == nil {
+			cfg.Root = &opns.RootConfig{}
+		}
+		cfg.Root.Topic = cfg.Topic
+		root, err := cfg.Root.Root()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTopic, err)
+		}
+		if _, ok := r.Engine.LookupServices[root.Service]; ok {
+			return fmt.Errorf("%w: lookup service %s already registered", ErrInvalidTopic, root.Service)
+		}
+		ls, err := r.app.LookupService(root)
+		if err != nil {
+			return err
+		}
+		r.Engine.LookupServices[root.Service] = ls
+		manager = opns.NewTopicManager(root)
+		service = root.Service
+	case TopicBSV21:
+		if len(cfg.TokenIDs) == 0 {
+			if tokenId, ok := strings.CutPrefix(cfg.Topic, "tm_"); ok && tokenId != "" {
+				cfg.TokenIDs = []string{tokenId}
+			} else {
+				return fmt.Errorf("%w: no token ids for %s", ErrInvalidTopic, cfg.Topic)
+			}
+		}
+		manager = topics.NewBsv21ValidatedTopicManager(cfg.Topic, r.app.Storage, cfg.TokenIDs)
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidTopic, cfg.Type)
+	}
+	r.Engine.SyncConfiguration[cfg.Topic] = syncConfig
+	r.Engine.Managers[cfg.Topic] = checked(manager)
+	r.configs[cfg.Topic] = cfg
+	if service != "" {
+		r.services[cfg.Topic] = service
+	}
+	return nil
+}
+
+// syncConfig is the engine's sync configuration for the topic. Topics
+// without one sync with the configured peers.
+func (r *TopicRegistry) syncConfig(cfg *TopicConfig) (engine.SyncConfiguration, error) {
+	syncCfg := cfg.Sync
+	if syncCfg == nil {
+		syncCfg = &SyncConfig{Type: "peers", Peers: r.app.Config.Peers}
+	}
+	return syncCfg.engineConfig()
+}
+
+// setSync applies the topic's sync configuration.
+func (r *TopicRegistry) setSync(cfg *TopicConfig) error {
+	if syncConfig, err := r.syncConfig(cfg); err != nil {
+		return err
+	} else {
+		r.Engine.SyncConfiguration[cfg.Topic] = syncConfig
+		return nil
+	}
+}
+
+func (r *TopicRegistry) persist(ctx context.Context, cfg *TopicConfig) error {
+	if data, err := json.Marshal(cfg); err != nil {
+		return err
+	} else {
+		return r.app.Redis.HSet(ctx, TopicConfigKey, cfg.Topic, data).Err()
+	}
+}
+
+// Add registers and persists a topic.
+func (r *TopicRegistry) Add(ctx context.Context, cfg *TopicConfig) error {
+	r.Lock()
+	defer r.Unlock()
+	if err := r.register(cfg); err != nil {
+		return err
+	} else if err := r.persist(ctx, cfg); err != nil {
+		r.unregister(cfg.Topic)
+		return err
+	}
+	return nil
+}
+
+func (r *TopicRegistry) unregister(topic string) {
+	delete(r.Engine.Managers, topic)
+	delete(r.Engine.SyncConfiguration, topic)
+	if service, ok := r.services[topic]; ok {
+		delete(r.Engine.LookupServices, service)
+		if ls, ok := r.app.lookups[service]; ok {
+			ls.Close()
+			delete(r.app.lookups, service)
+		}
+		delete(r.services, topic)
+	}
+	delete(r.configs, topic)
+}
+
+// Remove unregisters a topic added at runtime. Its indexed data is kept.
+func (r *TopicRegistry) Remove(ctx context.Context, topic string) error {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.configs[topic]; !ok {
+		return ErrTopicNotFound
+	} else if r.static[topic] {
+		return ErrTopicStatic
+	}
+	if _, err := r.app.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HDel(ctx, TopicConfigKey, topic)
+		p.SRem(ctx, LegacyTopicsKey, topic)
+		return nil
+	}); err != nil {
+		return err
+	}
+	r.unregister(topic)
+	return nil
+}
+
+// SetSync replaces a topic's sync configuration; nil restores the default.
+func (r *TopicRegistry) SetSync(ctx context.Context, topic string, syncCfg *SyncConfig) error {
+	r.Lock()
+	defer r.Unlock()
+	cfg, ok := r.configs[topic]
+	if !ok {
+		return ErrTopicNotFound
+	}
+	updated := *cfg
+	updated.Sync = syncCfg
+	if err := r.setSync(&updated); err != nil {
+		return err
+	} else if err := r.persist(ctx, &updated); err != nil {
+		r.setSync(cfg)
+		return err
+	}
+	r.configs[topic] = &updated
+	return nil
+}
+
+// List reports every registered topic.
+func (r *TopicRegistry) List() []*TopicInfo {
+	r.RLock()
+	defer r.RUnlock()
+	infos := make([]*TopicInfo, 0, len(r.configs))
+	for topic, cfg := range r.configs {
+		info := &TopicInfo{
+			TopicConfig: cfg,
+			Static:      r.static[topic],
+			MetaData:    r.Engine.Managers[topic].GetMetaData(),
+		}
+		if service, ok := r.services[topic]; ok {
+			info.Service = service
+			info.LookupMetaData = r.Engine.LookupServices[service].GetMetaData()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Topic < infos[j].Topic
+	})
+	return infos
+}
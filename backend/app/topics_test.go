@@ -0,0 +1,19 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+)
+
+func TestCheckedManager(t *testing.T) {
+	manager := checked(opns.NewTopicManager(opns.DefaultRoot))
+	if _, err := manager.IdentifyAdmissableOutputs(context.Background(), []byte("not a beef"), nil); !errors.Is(err, ErrTopicManager) {
+		t.Errorf("got %v, want ErrTopicManager", err)
+	}
+	if meta := manager.GetMetaData(); meta == nil || meta.Name != opns.DefaultRoot.Name {
+		t.Errorf("metadata %+v, want the wrapped manager's", meta)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+)
+
+var adminCommands = map[string]command{
+	"deadletter": runDeadLetter,
+	"reindex":    runReindex,
+}
+
+func runAdmin(ctx context.Context, a *app.App, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: opns admin deadletter|reindex [flags]")
+	} else if run, ok := adminCommands[args[0]]; !ok {
+		return fmt.Errorf("unknown admin command %q", args[0])
+	} else {
+		return run(ctx, a, args[1:])
+	}
+}
+
+func runDeadLetter(ctx context.Context, a *app.App, args []string) error {
+	var class string
+	fs := flag.NewFlagSet("deadletter", flag.ContinueOnError)
+	fs.StringVar(&class, "class", "", "Only transient, invalid, rejected or blocked entries")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: opns admin deadletter [-class c] list|requeue|drop [txid...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() < 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	txids := fs.Args()[1:]
+
+	dead, err := ingest.DeadLetters(ctx, a.Redis)
+	if err != nil {
+		return err
+	}
+	dead = slices.DeleteFunc(dead, func(d *ingest.DeadLetter) bool {
+		return (class != "" && string(d.Class) != class) ||
+			(len(txids) > 0 && !slices.Contains(txids, d.Txid))
+	})
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].Score < dead[j].Score
+	})
+
+	switch fs.Arg(0) {
+	case "list":
+		enc := json.NewEncoder(os.Stdout)
+		for _, d := range dead {
+			enc.Encode(d)
+		}
+	case "requeue":
+		if err := ingest.Requeue(ctx, a.Redis, dead...); err != nil {
+			return err
+		}
+		log.Printf("Requeued %d transactions", len(dead))
+	case "drop":
+		for _, d := range dead {
+			if err := a.Redis.HDel(ctx, ingest.DeadLetterKey, d.Txid).Err(); err != nil {
+				return err
+			}
+		}
+		log.Printf("Dropped %d transactions", len(dead))
+	default:
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	return nil
+}
+
+func runReindex(ctx context.Context, a *app.App, args []string) error {
+	var switchIndex bool
+	var topic string
+	fs := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	fs.BoolVar(&switchIndex, "switch", false, "Replace the live index with the rebuilt one")
+	fs.StringVar(&topic, "topic", "", "Only reindex this topic")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The registry knows the configured roots and those added at runtime.
+	registry := app.NewTopicRegistry(a, &engine.Engine{})
+	if err := registry.Load(ctx); err != nil {
+		return fmt.Errorf("failed to load topics: %w", err)
+	}
+	var found bool
+	for _, info := range registry.List() {
+		if info.Type != app.TopicOpNS || (topic != "" && info.Topic != topic) {
+			continue
+		}
+		found = true
+		lookupService := registry.Engine.LookupServices[info.Service].(*opns.LookupService)
+		if err := reindex(ctx, info.Topic, lookupService, switchIndex); err != nil {
+			return fmt.Errorf("%s: %w", info.Topic, err)
+		}
+	}
+	if !found && topic != "" {
+		return fmt.Errorf("%w: %s", app.ErrTopicNotFound, topic)
+	} else if !switchIndex {
+		log.Println("Run with -switch to replace the live index")
+	}
+	return nil
+}
+
+func reindex(ctx context.Context, topic string, lookupService *opns.LookupService, switchIndex bool) error {
+	report, err := lookupService.Reindex(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s: reindexed %d outputs, %d differ from the live index", topic, report.Outputs, len(report.Diffs))
+	encoder := json.NewEncoder(os.Stdout)
+	for _, diff := range report.Diffs {
+		encoder.Encode(diff)
+	}
+
+	if switchIndex {
+		if err := lookupService.Switch(ctx); err != nil {
+			return err
+		}
+		log.Printf("%s: switched to rebuilt index", topic)
+	}
+	return nil
+}
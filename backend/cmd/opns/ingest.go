@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+)
+
+func runIngest(ctx context.Context, a *app.App, args []string) error {
+	var subscription string
+	var fromBlock uint
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	fs.StringVar(&subscription, "sub", "408a5b6f79b151ad67d1c3a2f84256ca074c78faf31e64a0cab8e9707f360b37", "Subscription to ingest")
+	fs.UintVar(&fromBlock, "from", 800000, "Block to start from when there is no checkpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.Engine()
+	if err != nil {
+		return err
+	}
+	src, err := a.Source()
+	if err != nil {
+		return err
+	}
+	ingester := &ingest.Ingester{
+		Source:       src,
+		Engine:       e,
+		Topics:       a.Topics(),
+		Subscription: subscription,
+		FromBlock:    uint32(fromBlock),
+		Checkpoints:  a.Redis,
+	}
+	if err := ingester.Run(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
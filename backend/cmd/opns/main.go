@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+)
+
+type command func(ctx context.Context, a *app.App, args []string) error
+
+var commands = map[string]command{
+	"serve":     runServe,
+	"subscribe": runSubscribe,
+	"ingest":    runIngest,
+	"process":   runProcess,
+	"spends":    runSpends,
+	"prefetch":  runPrefetch,
+	"admin":     runAdmin,
+}
+
+func main() {
+	cfg, args, err := app.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if len(args) == 0 {
+		log.Fatalln("Usage: opns [flags] serve|subscribe|ingest|process|spends|prefetch|admin [command flags]")
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		log.Fatalf("Unknown command %q", args[0])
+	}
+	if cfg.EnvFile != "" {
+		log.Println("Loaded", cfg.EnvFile)
+	}
+
+	a, err := app.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize: %v", err)
+	}
+	ctx, cancel := app.SignalContext()
+	err = run(ctx, a, args[1:])
+	cancel()
+	a.Close()
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatalf("%s: %v", args[0], err)
+	}
+	log.Println("Application shutdown complete.")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+func runPrefetch(ctx context.Context, a *app.App, args []string) error {
+	var workers int
+	var queue string
+	fs := flag.NewFlagSet("prefetch", flag.ContinueOnError)
+	fs.IntVar(&workers, "workers", 10, "Concurrent fetches")
+	fs.StringVar(&queue, "queue", "opns", "Queue whose transactions are fetched")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	store, err := a.Source()
+	if err != nil {
+		return err
+	}
+
+	txidStrs, err := a.Redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     queue,
+		Stop:    "+inf",
+		Start:   "-inf",
+		ByScore: true,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	txids := make([]*chainhash.Hash, 0, len(txidStrs))
+	queued := make(map[chainhash.Hash]struct{}, len(txidStrs))
+	for _, txidStr := range txidStrs {
+		if txid, err := chainhash.NewHashFromHex(txidStr); err != nil {
+			log.Printf("Invalid txid %s: %v", txidStr, err)
+		} else {
+			txids = append(txids, txid)
+			queued[*txid] = struct{}{}
+		}
+	}
+
+	start := time.Now()
+	fetched := store.Prefetch(ctx, txids, workers, ingest.DefaultBackoff, func(txid *chainhash.Hash, attempts int, err error) {
+		log.Printf("Giving up on %s after %d attempts: %v", txid, attempts, err)
+		if _, ok := queued[*txid]; !ok {
+			return
+		} else if err := ingest.Bury(ctx, a.Redis, queue, txid.String(), attempts, err); err != nil {
+			log.Printf("Failed to dead-letter %s: %v", txid, err)
+		}
+	})
+	log.Println("Fetched", fetched, "transactions for", len(txids), "queued in", time.Since(start))
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+type tokenSummary struct {
+	tx  int
+	out int
+}
+
+func runProcess(ctx context.Context, a *app.App, args []string) error {
+	var workers, cacheSize int
+	fs := flag.NewFlagSet("process", flag.ContinueOnError)
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Transactions submitted concurrently")
+	fs.IntVar(&cacheSize, "cache", 100000, "Transactions kept in the parent cache")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := a.Engine()
+	if err != nil {
+		return err
+	}
+	src, err := a.Source()
+	if err != nil {
+		return err
+	}
+	tms := a.Topics()
+	genesisTxids := make([]string, 0, len(a.Roots))
+	for _, root := range a.Roots {
+		genesisTxids = append(genesisTxids, root.Genesis.Txid.String())
+	}
+
+	done := make(chan *tokenSummary, 1000)
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		txcount := 0
+		outcount := 0
+		lastTime := time.Now()
+		for {
+			select {
+			case summary := <-done:
+				txcount += summary.tx
+				outcount += summary.out
+			case <-ticker.C:
+				log.Printf("Processed tx %d o %d in %v %vtx/s\n", txcount, outcount, time.Since(lastTime), float64(txcount)/time.Since(lastTime).Seconds())
+				lastTime = time.Now()
+				txcount = 0
+				outcount = 0
+			case <-ctx.Done():
+				log.Println("Context canceled, stopping processing...")
+				return
+			}
+		}
+	}()
+
+	txidStrs, err := a.Redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     "opns",
+		Stop:    "+inf",
+		Start:   "-inf",
+		ByScore: true,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	txidStrs = append(genesisTxids, txidStrs...)
+	txids := make([]*chainhash.Hash, 0, len(txidStrs))
+	for _, txidStr := range txidStrs {
+		if txid, err := chainhash.NewHashFromHex(txidStr); err != nil {
+			return err
+		} else {
+			txids = append(txids, txid)
+		}
+	}
+
+	processor := &ingest.Processor{
+		Source:  ingest.NewCache(src, cacheSize),
+		Workers: workers,
+		Backoff: ingest.DefaultBackoff,
+		Submit: func(ctx context.Context, txid *chainhash.Hash, beef []byte) error {
+			logTime := time.Now()
+			if admit, err := e.Submit(ctx, overlay.TaggedBEEF{
+				Beef:   beef,
+				Topics: tms,
+			}, engine.SubmitModeHistorical, nil); err != nil {
+				return err
+			} else if err := a.Redis.ZRem(ctx, "opns", txid.String()).Err(); err != nil {
+				return err
+			} else {
+				outs := 0
+				for _, tm := range tms {
+					outs += len(admit[tm].OutputsToAdmit)
+				}
+				log.Println("Processed", txid, "in", time.Since(logTime), "as", outs, "outputs")
+				select {
+				case done <- &tokenSummary{tx: 1, out: outs}:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		},
+		OnFailure: func(ctx context.Context, txid *chainhash.Hash, attempts int, err error) {
+			log.Printf("Giving up on %s after %d attempts: %v", txid, attempts, err)
+			if err := ingest.Bury(ctx, a.Redis, "opns", txid.String(), attempts, err); err != nil {
+				log.Printf("Failed to dead-letter %s: %v", txid, err)
+			}
+		},
+	}
+	if err := processor.Process(ctx, txids); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
@@ -4,48 +4,43 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
-	"os/signal"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
 	"github.com/4chain-ag/go-overlay-services/pkg/core/gasp/core"
-	"github.com/b-open-io/bsv21-overlay/topics"
 	"github.com/bitcoin-sv/go-paymail/logging"
 	"github.com/bitcoin-sv/go-paymail/server"
 	"github.com/bsv-blockchain/go-sdk/chainhash"
 	"github.com/bsv-blockchain/go-sdk/overlay"
 	"github.com/bsv-blockchain/go-sdk/overlay/lookup"
-	"github.com/bsv-blockchain/go-sdk/overlay/topic"
+	"github.com/bsv-blockchain/go-sdk/spv"
 	"github.com/bsv-blockchain/go-sdk/transaction"
 	"github.com/bsv-blockchain/go-sdk/transaction/broadcaster"
-	"github.com/bsv-blockchain/go-sdk/transaction/chaintracker/headers_client"
+	opnsapp "github.com/bsvhackathon/GorillaPool/backend/app"
 	"github.com/bsvhackathon/GorillaPool/backend/opns"
+	"github.com/bsvhackathon/GorillaPool/backend/outbox"
 	opnspaymail "github.com/bsvhackathon/GorillaPool/backend/paymail"
-	"github.com/bsvhackathon/GorillaPool/backend/storage"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/redis/go-redis/v9"
 )
 
-var chaintracker headers_client.Client
-var PORT int
-var SYNC bool
 var rdb, sub *redis.Client
-var peers = []string{}
 
 type subRequest struct {
 	topics []string
@@ -54,92 +49,78 @@ type subRequest struct {
 
 var subscribe = make(chan *subRequest, 100)   // Buffered channel
 var unsubscribe = make(chan *subRequest, 100) // Buffered channel
-func init() {
-	godotenv.Load("../../.env")
-	chaintracker = headers_client.Client{
-		Url:    os.Getenv("BLOCK_HEADERS_URL"),
-		ApiKey: os.Getenv("BLOCK_HEADERS_API_KEY"),
-	}
-	PORT, _ = strconv.Atoi(os.Getenv("PORT"))
-	flag.IntVar(&PORT, "p", PORT, "Port to listen on")
-	flag.BoolVar(&SYNC, "s", false, "Start sync")
-	flag.Parse()
-	if PORT == 0 {
-		PORT = 3000
-	}
-	if redisOpts, err := redis.ParseURL(os.Getenv("REDIS")); err != nil {
-		log.Fatalf("Failed to parse Redis URL: %v", err)
-	} else {
-		rdb = redis.NewClient(redisOpts)
-		sub = redis.NewClient(redisOpts)
-	}
-	PEERS := os.Getenv("PEERS")
-	if PEERS != "" {
-		peers = strings.Split(PEERS, ",")
-	}
-}
 
-func main() {
-	// Create a context with cancellation
-	ctx, cancel := context.WithCancel(context.Background())
+func runServe(ctx context.Context, a *opnsapp.App, args []string) error {
+	var SYNC bool
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.BoolVar(&SYNC, "s", false, "Start sync")
+	syncInterval := fs.Duration("sync-interval", 10*time.Minute, "Time between GASP syncs with -s; 0 syncs once")
+	fullSyncInterval := fs.Duration("full-sync-interval", 24*time.Hour, "Time between GASP syncs run without checking the peer for new outputs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Channel to listen for OS signals
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-
-	hostingUrl := os.Getenv("HOSTING_URL")
-
-	storage, err := storage.NewRedisStorage(os.Getenv("REDIS"))
-	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+	rdb = a.Redis
+	if redisOpts, err := redis.ParseURL(a.Config.Redis); err != nil {
+		return err
+	} else {
+		sub = redis.NewClient(redisOpts)
 	}
-	defer storage.Close()
+	storage := a.Storage
+	chaintracker := a.ChainTracker
 
-	lookupService, err := opns.NewLookupService(
-		os.Getenv("REDIS"),
-		storage,
-		"tm_OpNS",
-	)
+	lookupService, err := a.LookupService(opns.DefaultRoot)
 	if err != nil {
-		log.Fatalf("Failed to initialize event lookup: %v", err)
+		return fmt.Errorf("failed to initialize event lookup: %w", err)
+	} else if err := lookupService.RebuildSaleTotals(ctx); err != nil {
+		return fmt.Errorf("failed to rebuild sale totals: %w", err)
+	} else if err := lookupService.RebuildNameIndex(ctx); err != nil {
+		return fmt.Errorf("failed to rebuild name indexes: %w", err)
 	}
 
-	e := engine.Engine{
-		Managers: map[string]engine.TopicManager{},
-		LookupServices: map[string]engine.LookupService{
-			"ls_OpNS": lookupService,
-		},
-		SyncConfiguration: map[string]engine.SyncConfiguration{},
+	e := &engine.Engine{
 		Broadcaster: &broadcaster.Arc{
 			ApiUrl:  "https://arc.taal.com",
 			WaitFor: broadcaster.ACCEPTED_BY_NETWORK,
 		},
-		HostingURL:   hostingUrl,
+		HostingURL:   a.Config.HostingURL,
 		Storage:      storage,
 		ChainTracker: chaintracker,
-		PanicOnError: true,
 	}
-	if tms, err := rdb.SMembers(ctx, "topics").Result(); err != nil {
-		log.Fatalf("Failed to get topics from Redis: %v", err)
-	} else {
-		for _, top := range tms {
-			log.Println("Adding topic manager:", top)
-			tokenId := top[3:]
-			e.Managers[top] = topics.NewBsv21ValidatedTopicManager(
-				top,
-				storage,
-				[]string{tokenId},
-			)
-			e.SyncConfiguration[top] = engine.SyncConfiguration{
-				Type:  engine.SyncConfigurationPeers,
-				Peers: peers,
-			}
+	topicRegistry := opnsapp.NewTopicRegistry(a, e)
+	if err := topicRegistry.Load(ctx); err != nil {
+		return fmt.Errorf("failed to load topics: %w", err)
+	}
+	for _, info := range topicRegistry.List() {
+		log.Println("Added topic manager:", info.Topic, info.Type)
+	}
+	syncer := opnsapp.NewSyncer(topicRegistry, *syncInterval)
+	syncer.FullInterval = *fullSyncInterval
+	peerOutbox := outbox.New(a.Redis)
+	go func() {
+		if err := peerOutbox.Run(ctx); err != nil {
+			log.Printf("Peer outbox stopped: %v", err)
+		}
+	}()
+
+	// withEngine holds the topic registry's read lock, so topics cannot
+	// change under a request using the engine.
+	withEngine := func(h fiber.Handler) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			topicRegistry.RLock()
+			defer topicRegistry.RUnlock()
+			return h(c)
 		}
 	}
 
 	// Create a new Fiber app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Hex bodies take two characters per byte of BEEF.
+		BodyLimit: max(fiber.DefaultBodyLimit, 2*a.Config.MaxBeefSize+64),
+	})
+	app.Use(recover.New())
 	app.Use(logger.New())
 	app.Use(compress.New())
 	app.Use(cors.New(cors.Config{AllowOrigins: "*"}))
@@ -148,50 +129,134 @@ func main() {
 		return c.SendString("Hello, World!")
 	})
 
-	app.Post("/submit", func(c *fiber.Ctx) error {
-		topicsHeader := c.Get("x-topics", "")
-		if topicsHeader == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Missing x-topics header",
+	app.Get("/listTopicManagers", withEngine(func(c *fiber.Ctx) error {
+		return c.JSON(e.ListTopicManagers())
+	}))
+
+	app.Get("/listLookupServiceProviders", withEngine(func(c *fiber.Ctx) error {
+		return c.JSON(e.ListLookupServiceProviders())
+	}))
+
+	app.Get("/sync/status", func(c *fiber.Ctx) error {
+		if states, err := syncer.Status(c.Context()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(fiber.Map{
+				"enabled":  SYNC,
+				"interval": syncInterval.String(),
+				"peers":    states,
 			})
 		}
-		taggedBeef := overlay.TaggedBEEF{}
-		if err := json.Unmarshal([]byte(topicsHeader), &taggedBeef.Topics); err != nil {
+	})
+
+	app.Get("/outbox/status", func(c *fiber.Ctx) error {
+		if stats, err := peerOutbox.Stats(c.Context()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(stats)
+		}
+	})
+
+	admin := app.Group("/admin", func(c *fiber.Ctx) error {
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if a.Config.AdminToken == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Admin API is disabled",
+			})
+		} else if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.Config.AdminToken)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+		return c.Next()
+	})
+
+	admin.Get("/topics", func(c *fiber.Ctx) error {
+		return c.JSON(topicRegistry.List())
+	})
+
+	admin.Post("/topics", func(c *fiber.Ctx) error {
+		var cfg opnsapp.TopicConfig
+		if err := c.BodyParser(&cfg); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Invalid x-topics header",
+				"error": "Invalid request body",
+			})
+		} else if err := topicRegistry.Add(c.Context(), &cfg); errors.Is(err, opnsapp.ErrTopicExists) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if errors.Is(err, opnsapp.ErrInvalidTopic) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
 			})
 		}
-		copy(taggedBeef.Beef, c.Body())
-		onSteakReady := func(steak *overlay.Steak) {
-			for top, admit := range *steak {
-				if sync, ok := e.SyncConfiguration[top]; !ok {
-					continue
-				} else if sync.Type == engine.SyncConfigurationPeers && len(admit.CoinsToRetain) > 0 || len(admit.OutputsToAdmit) > 0 {
-					for _, peer := range sync.Peers {
-						if _, err := (&topic.HTTPSOverlayBroadcastFacilitator{Client: http.DefaultClient}).Send(peer, &overlay.TaggedBEEF{
-							Beef:   taggedBeef.Beef,
-							Topics: []string{top},
-						}); err != nil {
-							log.Printf("Error submitting taggedBEEF to peer %s: %v", peer, err)
-						}
-					}
-				}
+		log.Println("Added topic manager:", cfg.Topic, cfg.Type)
+		return c.Status(fiber.StatusCreated).JSON(cfg)
+	})
+
+	admin.Delete("/topics/:topic", func(c *fiber.Ctx) error {
+		topic := c.Params("topic")
+		if err := topicRegistry.Remove(c.Context(), topic); errors.Is(err, opnsapp.ErrTopicNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if errors.Is(err, opnsapp.ErrTopicStatic) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Println("Removed topic manager:", topic)
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	admin.Put("/topics/:topic/sync", func(c *fiber.Ctx) error {
+		var syncCfg *opnsapp.SyncConfig
+		if len(c.Body()) > 0 {
+			syncCfg = &opnsapp.SyncConfig{}
+			if err := c.BodyParser(syncCfg); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid request body",
+				})
 			}
 		}
-		if steak, err := e.Submit(c.Context(), taggedBeef, engine.SubmitModeCurrent, onSteakReady); err != nil {
+		if err := topicRegistry.SetSync(c.Context(), c.Params("topic"), syncCfg); errors.Is(err, opnsapp.ErrTopicNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if errors.Is(err, opnsapp.ErrInvalidTopic) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": err.Error(),
 			})
-		} else {
-			return c.JSON(steak)
 		}
-
+		return c.SendStatus(fiber.StatusNoContent)
 	})
 
-	app.Post("/requestSyncResponse", func(c *fiber.Ctx) error {
+	app.Post("/submit", withEngine(submitHandler(e, a.Config.MaxBeefSize, submitCurrent(e, peerOutbox))))
+
+	app.Post("/requestSyncResponse", withEngine(func(c *fiber.Ctx) error {
 		var request core.GASPInitialRequest
-		topic := c.Get("x-bsv-topic", "bsv21")
-		if err := c.BodyParser(&request); err != nil {
+		topic := c.Get("x-bsv-topic")
+		if _, ok := e.Managers[topic]; !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown or missing x-bsv-topic header",
+			})
+		} else if err := c.BodyParser(&request); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Invalid request",
 			})
@@ -202,9 +267,9 @@ func main() {
 		} else {
 			return c.JSON(response)
 		}
-	})
+	}))
 
-	app.Post("/requestForeignGASPNode", func(c *fiber.Ctx) error {
+	app.Post("/requestForeignGASPNode", withEngine(func(c *fiber.Ctx) error {
 		var request core.GASPNodeRequest
 		if err := c.BodyParser(&request); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -221,23 +286,93 @@ func main() {
 		} else {
 			return c.JSON(response)
 		}
-	})
+	}))
 
-	app.Post("/lookup", func(c *fiber.Ctx) error {
+	app.Post("/lookup", withEngine(func(c *fiber.Ctx) error {
 		var question lookup.LookupQuestion
 		if err := c.BodyParser(&question); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Invalid request",
 			})
 		} else if answer, err := e.Lookup(c.Context(), &question); err != nil {
+			var qerr opns.QueryErrors
+			if errors.As(err, &qerr) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error":   "Invalid query",
+					"details": qerr,
+				})
+			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		} else {
 			return c.JSON(answer)
 		}
+	}))
+
+	app.Post("/resolve", func(c *fiber.Ctx) error {
+		var request struct {
+			Names []string `json:"names"`
+		}
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		} else if len(request.Names) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Missing names",
+			})
+		} else if len(request.Names) > opns.MaxResolveNames {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("At most %d names may be resolved at once", opns.MaxResolveNames),
+			})
+		} else if results, err := lookupService.Resolve(c.Context(), request.Names); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(results)
+		}
 	})
 
+	for path, build := range map[string]func(context.Context, *opns.TradeRequest) (*opns.UnsignedTx, error){
+		"/tx/transfer": lookupService.BuildTransfer,
+		"/tx/list":     lookupService.BuildListing,
+		"/tx/cancel":   lookupService.BuildCancel,
+		"/tx/purchase": lookupService.BuildPurchase,
+	} {
+		app.Post(path, func(c *fiber.Ctx) error {
+			var request opns.TradeRequest
+			if err := c.BodyParser(&request); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Invalid request",
+				})
+			} else if request.Domain == "" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "Missing domain",
+				})
+			} else if unsigned, err := build(c.Context(), &request); errors.Is(err, opns.ErrNameNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			} else if errors.Is(err, opns.ErrListed) || errors.Is(err, opns.ErrNotListed) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			} else if errors.Is(err, opns.ErrInvalidTrade) || errors.Is(err, transaction.ErrInsufficientInputs) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			} else {
+				return c.JSON(unsigned)
+			}
+		})
+	}
+
 	app.Get("/owner/:name", func(c *fiber.Ctx) error {
 		name := c.Params("name")
 		if name == "" {
@@ -262,16 +397,22 @@ func main() {
 				"error": err.Error(),
 			})
 		} else {
-			var address string
+			var address, scriptHash, ownerType string
 			for _, event := range events {
 				if strings.HasPrefix(event, "p2pkh:") {
 					address = strings.TrimPrefix(event, "p2pkh:")
+				} else if strings.HasPrefix(event, "owner:") {
+					scriptHash = strings.TrimPrefix(event, "owner:")
+				} else if strings.HasPrefix(event, "lock:") {
+					ownerType = strings.TrimPrefix(event, "lock:")
 				}
 			}
 
 			return c.JSON(fiber.Map{
-				"address":  address,
-				"outpoint": outputs[0].Outpoint.OrdinalString(),
+				"address":    address,
+				"scriptHash": scriptHash,
+				"type":       ownerType,
+				"outpoint":   outputs[0].Outpoint.OrdinalString(),
 			})
 		}
 	})
@@ -301,6 +442,86 @@ func main() {
 		}
 	})
 
+	app.Get("/market/listings", func(c *fiber.Ctx) error {
+		sort := opns.ListingSort(c.Query("sort", string(opns.ListingSortRecent)))
+		if !sort.Valid() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid sort",
+			})
+		}
+		limit := c.QueryInt("limit", 100)
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+		if listings, err := lookupService.FindListings(c.Context(), sort, c.QueryInt("offset", 0), limit, c.QueryBool("rev", false)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else if floor, err := lookupService.FloorPrice(c.Context()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(fiber.Map{
+				"listings": listings,
+				"floor":    floor,
+			})
+		}
+	})
+
+	app.Get("/market/sales", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 100)
+		if limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+		if sales, err := lookupService.FindSales(c.Context(), c.QueryInt("offset", 0), limit); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(sales)
+		}
+	})
+
+	app.Get("/market/sales/volume", func(c *fiber.Ctx) error {
+		days := c.QueryInt("days", 30)
+		if days <= 0 {
+			days = 30
+		}
+		since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+		if volumes, err := lookupService.VolumePerDay(c.Context(), since); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(volumes)
+		}
+	})
+
+	app.Get("/market/sales/median", func(c *fiber.Ctx) error {
+		if medians, err := lookupService.MedianPriceByLength(c.Context()); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(medians)
+		}
+	})
+
+	app.Get("/market/sales/top", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", 10)
+		if limit <= 0 || limit > 1000 {
+			limit = 10
+		}
+		if sales, err := lookupService.TopSales(c.Context(), limit); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		} else {
+			return c.JSON(sales)
+		}
+	})
+
 	// Stripe checkout session endpoint
 	app.Post("/create-checkout-session", func(c *fiber.Ctx) error {
 		// Get form values directly - no need to parse body first in Fiber
@@ -327,7 +548,7 @@ func main() {
 		}
 
 		// Create the checkout session using Stripe API
-		stripeKey := os.Getenv("STRIPE_SECRET_KEY")
+		stripeKey := a.Config.StripeSecretKey
 		if stripeKey == "" {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Stripe key not configured",
@@ -428,7 +649,7 @@ func main() {
 			})
 		}
 
-		answer, err := e.Lookup(c.Context(), &lookup.LookupQuestion{
+		answer, err := lookupService.Lookup(c.Context(), &lookup.LookupQuestion{
 			Service: "ls_OpNS",
 			Query:   json.RawMessage(b),
 		})
@@ -537,7 +758,7 @@ func main() {
 	// Stripe webhook endpoint for handling payment events
 	app.Post("/stripe-webhook", func(c *fiber.Ctx) error {
 		// Get the stripe webhook secret from env
-		webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+		webhookSecret := a.Config.StripeWebhookSecret
 		if webhookSecret == "" {
 			log.Println("Warning: STRIPE_WEBHOOK_SECRET not set")
 		}
@@ -716,7 +937,7 @@ func main() {
 		})
 	})
 
-	app.Post("/arc-ingest", func(c *fiber.Ctx) error {
+	app.Post("/arc-ingest", withEngine(func(c *fiber.Ctx) error {
 		var status broadcaster.ArcResponse
 		if err := c.BodyParser(&status); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -739,7 +960,7 @@ func main() {
 				"status": "success",
 			})
 		}
-	})
+	}))
 
 	app.Get("/subscribe/:topics", func(c *fiber.Ctx) error {
 		topicsParam := c.Params("topics")
@@ -820,7 +1041,7 @@ func main() {
 			})
 		}
 
-		answer, err := e.Lookup(c.Context(), &lookup.LookupQuestion{
+		answer, err := lookupService.Lookup(c.Context(), &lookup.LookupQuestion{
 			Service: "ls_OpNS",
 			Query:   json.RawMessage(b),
 		})
@@ -1029,29 +1250,21 @@ func main() {
 		}
 	}()
 
-	// Goroutine to handle OS signals
+	// Shut down when the command's context is canceled
 	go func() {
-		<-signalChan
+		<-ctx.Done()
 		log.Println("Shutting down server...")
 
-		// Cancel the context to stop goroutines
-		cancel()
-
 		// Gracefully shut down the Fiber app
 		if err := app.Shutdown(); err != nil {
-			log.Fatalf("Error shutting down server: %v", err)
+			log.Printf("Error shutting down server: %v", err)
 		}
 
-		// Close Redis connections
-		if err := rdb.Close(); err != nil {
-			log.Printf("Error closing Redis client: %v", err)
-		}
 		if err := sub.Close(); err != nil {
 			log.Printf("Error closing Redis subscription client: %v", err)
 		}
 
 		log.Println("Server stopped.")
-		os.Exit(0)
 	}()
 
 	// hack in paymail for now
@@ -1078,7 +1291,7 @@ func main() {
 			server.WithP2PCapabilities(),
 			server.WithBeefCapabilities(),
 			// server.WithDomain("1sat.app"),
-			server.WithDomain(os.Getenv("PAYMAIL_DOMAIN")),
+			server.WithDomain(a.Config.PaymailDomain),
 			// server.WithDomain("localhost:3000"),
 			// server.WithGenericCapabilities(),
 			server.WithPort(port),
@@ -1095,15 +1308,156 @@ func main() {
 		server.StartServer(server.CreateServer(config), config.Logger)
 	}()
 
+	go lookupService.WatchReorgs(ctx, time.Minute, 100)
+	go lookupService.WatchSaleTimes(ctx, time.Minute)
+
 	if SYNC {
-		if err := e.StartGASPSync(context.Background()); err != nil {
-			log.Fatalf("Error starting sync: %v", err)
-		}
+		go syncer.Run(ctx)
 	}
 	// Start the server on the specified port
-	if err := app.Listen(fmt.Sprintf(":%d", PORT)); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	return app.Listen(fmt.Sprintf(":%d", a.Config.Port))
+}
+
+var errBeefTooLarge = errors.New("BEEF too large")
+
+// readBeef decodes a /submit body, which is raw BEEF or, unless sent as
+// application/octet-stream, may be hex.
+func readBeef(body []byte, contentType string, maxSize int) ([]byte, error) {
+	beef := body
+	if !strings.HasPrefix(contentType, fiber.MIMEOctetStream) {
+		if text := bytes.TrimSpace(body); len(text) > 0 && isHex(text) {
+			beef = make([]byte, hex.DecodedLen(len(text)))
+			if _, err := hex.Decode(beef, text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(beef) == 0 {
+		return nil, errors.New("empty body")
+	} else if len(beef) > maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", errBeefTooLarge, len(beef), maxSize)
 	}
+	return beef, nil
+}
+
+func isHex(text []byte) bool {
+	for _, b := range text {
+		if (b < '0' || b > '9') && (b < 'a' || b > 'f') && (b < 'A' || b > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// submitCurrent submits a transaction to e as current, queueing it for the
+// peers of every topic that admitted it.
+func submitCurrent(e *engine.Engine, peerOutbox *outbox.Outbox) func(context.Context, overlay.TaggedBEEF, *transaction.Transaction) (overlay.Steak, error) {
+	return func(ctx context.Context, taggedBeef overlay.TaggedBEEF, tx *transaction.Transaction) (overlay.Steak, error) {
+		return e.Submit(ctx, taggedBeef, engine.SubmitModeCurrent, func(steak *overlay.Steak) {
+			for top, admit := range *steak {
+				if sync, ok := e.SyncConfiguration[top]; !ok {
+					continue
+				} else if sync.Type == engine.SyncConfigurationPeers && admitted(admit) {
+					for _, peer := range sync.Peers {
+						if peer == e.HostingURL {
+							continue
+						} else if err := peerOutbox.Enqueue(ctx, peer, top, tx.TxID().String(), taggedBeef.Beef); err != nil {
+							log.Printf("Error queueing %s for peer %s: %v", tx.TxID(), peer, err)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func admitted(admit *overlay.AdmittanceInstructions) bool {
+	return admit != nil && (len(admit.OutputsToAdmit) > 0 || len(admit.CoinsToRetain) > 0)
+}
+
+// topicResult is the entry of a topic in the /submit response: its
+// admittance instructions, with a code of "rejected" when it admitted no
+// outputs and retained no coins. The extra field leaves the response
+// readable as a STEAK.
+type topicResult struct {
+	*overlay.AdmittanceInstructions
+	Code string `json:"code,omitempty"`
+}
+
+// submitHandler serves POST /submit. The BEEF is checked against the
+// topics and chain tracker of e before it is passed to submit. The response
+// has an entry for every requested topic, and the X-Submit-Code header is
+// "rejected" when none of them admitted the transaction. A topic manager
+// refusing the transaction is answered with 422.
+func submitHandler(e *engine.Engine, maxBeefSize int, submit func(context.Context, overlay.TaggedBEEF, *transaction.Transaction) (overlay.Steak, error)) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		topicsHeader := c.Get("x-topics", "")
+		if topicsHeader == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Missing x-topics header",
+			})
+		}
+		taggedBeef := overlay.TaggedBEEF{}
+		if err := json.Unmarshal([]byte(topicsHeader), &taggedBeef.Topics); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid x-topics header",
+			})
+		}
+		if beef, err := readBeef(c.Body(), c.Get(fiber.HeaderContentType), maxBeefSize); errors.Is(err, errBeefTooLarge) {
+			return submitError(c, fiber.StatusRequestEntityTooLarge, "beef-too-large", err)
+		} else if err != nil {
+			return submitError(c, fiber.StatusBadRequest, "malformed-beef", err)
+		} else {
+			taggedBeef.Beef = beef
+		}
+		for _, top := range taggedBeef.Topics {
+			if _, ok := e.Managers[top]; !ok {
+				return submitError(c, fiber.StatusBadRequest, "unknown-topic", fmt.Errorf("unknown topic %s", top))
+			}
+		}
+		_, tx, _, err := transaction.ParseBeef(taggedBeef.Beef)
+		if err != nil {
+			return submitError(c, fiber.StatusBadRequest, "malformed-beef", err)
+		} else if tx == nil {
+			return submitError(c, fiber.StatusBadRequest, "malformed-beef", errors.New("BEEF does not name a subject transaction"))
+		} else if valid, err := spv.Verify(tx, e.ChainTracker, nil); err != nil {
+			return submitError(c, fiber.StatusUnprocessableEntity, "spv-failed", err)
+		} else if !valid {
+			return submitError(c, fiber.StatusUnprocessableEntity, "spv-failed", errors.New("transaction failed SPV verification"))
+		}
+		steak, err := submit(c.Context(), taggedBeef, tx)
+		if errors.Is(err, opnsapp.ErrTopicManager) {
+			return submitError(c, fiber.StatusUnprocessableEntity, "rejected", err)
+		} else if err != nil {
+			log.Printf("Error submitting BEEF: %v", err)
+			return submitError(c, fiber.StatusInternalServerError, "internal", errors.New("failed to process transaction"))
+		}
+		results := make(map[string]*topicResult, len(taggedBeef.Topics))
+		rejected := true
+		for _, top := range taggedBeef.Topics {
+			result := &topicResult{AdmittanceInstructions: steak[top]}
+			if result.AdmittanceInstructions == nil {
+				result.AdmittanceInstructions = &overlay.AdmittanceInstructions{}
+			}
+			if admitted(result.AdmittanceInstructions) {
+				rejected = false
+			} else {
+				result.Code = "rejected"
+			}
+			results[top] = result
+		}
+		if rejected {
+			c.Set("X-Submit-Code", "rejected")
+		}
+		return c.JSON(results)
+	}
+}
+
+func submitError(c *fiber.Ctx, status int, code string, err error) error {
+	return c.Status(status).JSON(fiber.Map{
+		"code":  code,
+		"error": err.Error(),
+	})
 }
 
 // Helper function to check if a name has been paid for
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	opnsapp "github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+	"github.com/bsvhackathon/GorillaPool/backend/outbox"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The claim fixture of opns/validate_test.go: a nonce mined for claimPow and
+// 'a' at the default difficulty.
+var claimPow = bytes.Repeat([]byte{0x11}, 32)
+
+const claimNonce = "c1767a0000000000000000000000000000000000000000000000000000000000"
+
+var claimOwner, _ = script.NewFromHex("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+
+const (
+	otherTopic = "tm_other"
+	selfURL    = "https://self.example"
+	peerURL    = "https://peer.example"
+)
+
+// headers accepts every merkle root, or none.
+type headers bool
+
+func (h headers) IsValidRootForHeight(root *chainhash.Hash, height uint32) (bool, error) {
+	return bool(h), nil
+}
+
+// broadcast accepts every transaction.
+type broadcast struct{}
+
+func (broadcast) Broadcast(tx *transaction.Transaction) (*transaction.BroadcastSuccess, *transaction.BroadcastFailure) {
+	return &transaction.BroadcastSuccess{Txid: tx.TxID().String()}, nil
+}
+
+func (b broadcast) BroadcastCtx(ctx context.Context, tx *transaction.Transaction) (*transaction.BroadcastSuccess, *transaction.BroadcastFailure) {
+	return b.Broadcast(tx)
+}
+
+// refusing is a topic manager that refuses every transaction, as the app's
+// managers report it.
+type refusing struct {
+	engine.TopicManager
+}
+
+func (refusing) IdentifyAdmissableOutputs(ctx context.Context, beef []byte, previousCoins []uint32) (overlay.AdmittanceInstructions, error) {
+	return overlay.AdmittanceInstructions{}, fmt.Errorf("%w: not for this topic", opnsapp.ErrTopicManager)
+}
+
+type submitApp struct {
+	*fiber.App
+	app    *opnsapp.App
+	engine *engine.Engine
+	outbox *outbox.Outbox
+	redis  *miniredis.Miniredis
+}
+
+// newSubmitApp serves /submit from the engine of an app on miniredis, with
+// the default root and a second OpNS topic manager under otherTopic. The
+// default topic syncs with peerURL and the app itself.
+func newSubmitApp(t *testing.T, chain headers, maxBeefSize int) *submitApp {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	a, err := opnsapp.New(&opnsapp.Config{
+		Redis:        "redis://" + mr.Addr(),
+		IngestSource: "file:" + t.TempDir(),
+		HostingURL:   selfURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	e, err := a.Engine()
+	if err != nil {
+		t.Fatal(err)
+	} else if other, err := (&opns.RootConfig{Topic: otherTopic}).Root(); err != nil {
+		t.Fatal(err)
+	} else {
+		e.Managers[otherTopic] = opns.NewTopicManager(other)
+	}
+	e.ChainTracker = chain
+	e.Broadcaster = broadcast{}
+	e.SyncConfiguration = map[string]engine.SyncConfiguration{
+		opns.DefaultRoot.Topic: {Type: engine.SyncConfigurationPeers, Peers: []string{peerURL, selfURL}},
+	}
+	s := &submitApp{App: fiber.New(), app: a, engine: e, outbox: outbox.New(a.Redis), redis: mr}
+	s.Post("/submit", submitHandler(e, maxBeefSize, submitCurrent(e, s.outbox)))
+	return s
+}
+
+// minedParent is a transaction with outputs in a block accepted by headers.
+func minedParent(outputs ...*transaction.TransactionOutput) *transaction.Transaction {
+	parent := transaction.NewTransaction()
+	parent.AddInput(&transaction.TransactionInput{
+		SourceTXID:       &chainhash.Hash{},
+		SourceTxOutIndex: 0xffffffff,
+		UnlockingScript:  script.NewFromBytes([]byte{0x01, 0x64}),
+		SequenceNumber:   0xffffffff,
+	})
+	parent.Outputs = outputs
+	isTxid := true
+	parent.MerklePath = transaction.NewMerklePath(100, [][]*transaction.PathElement{{
+		{Offset: 0, Hash: parent.TxID(), Txid: &isTxid},
+		{Offset: 1, Duplicate: &isTxid},
+	}})
+	return parent
+}
+
+// claimBeef claims 'a' from a default root contract, which is first
+// admitted to the app if admit is set, returning the BEEF of the claim and
+// its txid.
+func (s *submitApp) claimBeef(t *testing.T, admit bool) ([]byte, *chainhash.Hash) {
+	t.Helper()
+	nonce, err := hex.DecodeString(claimNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := opns.Lock([]byte{0x00}, "", claimPow)
+	o := opns.Decode(lock)
+	source := minedParent(&transaction.TransactionOutput{LockingScript: lock, Satoshis: 1})
+	sourceBeef, err := source.BEEF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admit {
+		if err := s.app.Storage.InsertOutput(context.Background(), &engine.Output{
+			Outpoint: overlay.Outpoint{Txid: *source.TxID(), OutputIndex: 0},
+			Topic:    opns.DefaultRoot.Topic,
+			Script:   lock,
+			Satoshis: 1,
+			Beef:     sourceBeef,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Build the claim as OpnsUnlocker.Sign would with the mined nonce.
+	hash := chainhash.DoubleHashB(append(append(append([]byte{}, claimPow...), 'a'), nonce...))
+	tx := transaction.NewTransaction()
+	tx.AddInputsFromUTXOs(&transaction.UTXO{TxID: source.TxID(), Vout: 0, LockingScript: lock, Satoshis: 1})
+	tx.Inputs[0].SourceTransaction = source
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: opns.Lock(o.Claim('a'), "", hash), Satoshis: 1})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: opns.Lock([]byte{0x00}, "a", hash), Satoshis: 1})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: o.BuildInscription("a", claimOwner), Satoshis: 1})
+	preimage, err := tx.CalcInputPreimage(0, sighash.All|sighash.AnyOneCanPayForkID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock := &script.Script{}
+	unlock.AppendPushData([]byte{'a'})
+	unlock.AppendPushData(nonce)
+	unlock.AppendPushData(*claimOwner)
+	unlock.AppendPushData([]byte{})
+	unlock.AppendPushData(preimage)
+	tx.Inputs[0].UnlockingScript = unlock
+
+	beef, err := tx.BEEF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return beef, tx.TxID()
+}
+
+// plainBeef is a transaction spending an OP_TRUE output of a mined parent,
+// which no OpNS topic admits.
+func plainBeef(t *testing.T) []byte {
+	t.Helper()
+	parent := minedParent(&transaction.TransactionOutput{LockingScript: script.NewFromBytes([]byte{script.OpTRUE}), Satoshis: 1000})
+	tx := transaction.NewTransaction()
+	tx.AddInput(&transaction.TransactionInput{
+		SourceTXID:        parent.TxID(),
+		SourceTransaction: parent,
+		UnlockingScript:   &script.Script{},
+		SequenceNumber:    0xffffffff,
+	})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: script.NewFromBytes([]byte{script.OpTRUE}), Satoshis: 900})
+	beef, err := tx.BEEF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return beef
+}
+
+type submitResponse struct {
+	status int
+	code   string
+	body   map[string]any
+}
+
+func postSubmit(t *testing.T, app *submitApp, topics, contentType string, body []byte) *submitResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/submit", bytes.NewReader(body))
+	req.Header.Set("x-topics", topics)
+	req.Header.Set(fiber.HeaderContentType, contentType)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	result := &submitResponse{status: resp.StatusCode, code: resp.Header.Get("X-Submit-Code")}
+	if err := json.NewDecoder(resp.Body).Decode(&result.body); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// pending reports the deliveries queued for each peer.
+func (s *submitApp) pending(t *testing.T) map[string]int64 {
+	t.Helper()
+	stats, err := s.outbox.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := map[string]int64{}
+	for _, stat := range stats {
+		pending[stat.Peer] = stat.Pending
+	}
+	return pending
+}
+
+func TestSubmit(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		hex         bool
+	}{
+		{"raw", fiber.MIMEOctetStream, false},
+		{"hex", fiber.MIMETextPlain, true},
+		{"raw without content type", "", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSubmitApp(t, true, 1<<20)
+			beef, txid := app.claimBeef(t, true)
+			body := beef
+			if tt.hex {
+				body = []byte(hex.EncodeToString(beef) + "\n")
+			}
+			resp := postSubmit(t, app, fmt.Sprintf(`[%q]`, opns.DefaultRoot.Topic), tt.contentType, body)
+			if resp.status != fiber.StatusOK {
+				t.Fatalf("status %d, want 200: %v", resp.status, resp.body)
+			} else if resp.code != "" {
+				t.Errorf("X-Submit-Code %q, want none", resp.code)
+			}
+
+			var steak overlay.Steak
+			raw, _ := json.Marshal(resp.body)
+			if err := json.Unmarshal(raw, &steak); err != nil {
+				t.Fatalf("response is not a STEAK: %v", err)
+			} else if admit := steak[opns.DefaultRoot.Topic]; admit == nil || !slices.Equal(admit.OutputsToAdmit, []uint32{0, 1, 2}) {
+				t.Errorf("admitted %+v, want outputs 0, 1 and 2", admit)
+			} else if entry := resp.body[opns.DefaultRoot.Topic].(map[string]any); entry["code"] != nil {
+				t.Errorf("admitted topic has code %v", entry["code"])
+			}
+			for vout := uint32(0); vout < 3; vout++ {
+				topic := opns.DefaultRoot.Topic
+				if output, err := app.app.Storage.FindOutput(context.Background(), &overlay.Outpoint{Txid: *txid, OutputIndex: vout}, &topic, nil, false); err != nil {
+					t.Fatal(err)
+				} else if output == nil {
+					t.Errorf("output %d was not stored", vout)
+				}
+			}
+			if pending := app.pending(t); pending[peerURL] != 1 || pending[selfURL] != 0 {
+				t.Errorf("queued %v, want one delivery to %s only", pending, peerURL)
+			}
+		})
+	}
+}
+
+func TestSubmitRejected(t *testing.T) {
+	app := newSubmitApp(t, true, 1<<20)
+	beef, _ := app.claimBeef(t, false)
+	resp := postSubmit(t, app, fmt.Sprintf(`[%q,%q]`, opns.DefaultRoot.Topic, otherTopic), fiber.MIMEOctetStream, beef)
+	if resp.status != fiber.StatusOK {
+		t.Fatalf("status %d, want 200: %v", resp.status, resp.body)
+	} else if resp.code != "rejected" {
+		t.Errorf("X-Submit-Code %q, want rejected", resp.code)
+	}
+	// Each topic reports its own rejection.
+	for _, top := range []string{opns.DefaultRoot.Topic, otherTopic} {
+		if entry, ok := resp.body[top].(map[string]any); !ok {
+			t.Errorf("response %v has no %s", resp.body, top)
+		} else if entry["code"] != "rejected" {
+			t.Errorf("%s: code %v, want rejected", top, entry["code"])
+		} else if entry["OutputsToAdmit"] != nil || entry["CoinsToRetain"] != nil {
+			t.Errorf("%s: got %v, want nothing admitted", top, entry)
+		}
+	}
+	if pending := app.pending(t); len(pending) != 0 {
+		t.Errorf("queued %v for a rejected transaction", pending)
+	}
+}
+
+func TestSubmitPartlyRejected(t *testing.T) {
+	app := newSubmitApp(t, true, 1<<20)
+	beef, _ := app.claimBeef(t, true)
+	resp := postSubmit(t, app, fmt.Sprintf(`[%q,%q]`, opns.DefaultRoot.Topic, otherTopic), fiber.MIMEOctetStream, beef)
+	if resp.status != fiber.StatusOK || resp.code != "" {
+		t.Fatalf("got %d %q, want 200 without a code: %v", resp.status, resp.code, resp.body)
+	} else if entry := resp.body[otherTopic].(map[string]any); entry["code"] != "rejected" {
+		t.Errorf("%s: code %v, want rejected", otherTopic, entry["code"])
+	} else if entry := resp.body[opns.DefaultRoot.Topic].(map[string]any); entry["code"] != nil {
+		t.Errorf("%s: code %v, want none", opns.DefaultRoot.Topic, entry["code"])
+	}
+}
+
+func TestSubmitErrors(t *testing.T) {
+	beef := plainBeef(t)
+	defaultTopic := fmt.Sprintf(`[%q]`, opns.DefaultRoot.Topic)
+	for _, tt := range []struct {
+		name        string
+		chain       headers
+		maxBeefSize int
+		setup       func(app *submitApp)
+		topics      string
+		contentType string
+		body        []byte
+		status      int
+		code        string
+	}{
+		{"oversized raw", true, len(beef) - 1, nil, defaultTopic, fiber.MIMEOctetStream, beef, fiber.StatusRequestEntityTooLarge, "beef-too-large"},
+		{"oversized hex", true, len(beef) - 1, nil, defaultTopic, fiber.MIMETextPlain, []byte(hex.EncodeToString(beef)), fiber.StatusRequestEntityTooLarge, "beef-too-large"},
+		{"empty", true, len(beef), nil, defaultTopic, fiber.MIMEOctetStream, nil, fiber.StatusBadRequest, "malformed-beef"},
+		{"malformed", true, len(beef), nil, defaultTopic, fiber.MIMEOctetStream, []byte("not a beef"), fiber.StatusBadRequest, "malformed-beef"},
+		{"odd hex", true, len(beef), nil, defaultTopic, fiber.MIMETextPlain, []byte("abc"), fiber.StatusBadRequest, "malformed-beef"},
+		{"truncated", true, len(beef), nil, defaultTopic, fiber.MIMEOctetStream, beef[:len(beef)/2], fiber.StatusBadRequest, "malformed-beef"},
+		{"unknown topic", true, len(beef), nil, `["tm_OpNS","tm_unknown"]`, fiber.MIMEOctetStream, beef, fiber.StatusBadRequest, "unknown-topic"},
+		{"spv failure", false, len(beef), nil, defaultTopic, fiber.MIMEOctetStream, beef, fiber.StatusUnprocessableEntity, "spv-failed"},
+		{"topic manager refusal", true, len(beef), func(app *submitApp) {
+			app.engine.Managers[otherTopic] = refusing{app.engine.Managers[otherTopic]}
+		}, fmt.Sprintf(`[%q]`, otherTopic), fiber.MIMEOctetStream, beef, fiber.StatusUnprocessableEntity, "rejected"},
+		{"storage failure", true, len(beef), func(app *submitApp) {
+			app.redis.Close()
+		}, defaultTopic, fiber.MIMEOctetStream, beef, fiber.StatusInternalServerError, "internal"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newSubmitApp(t, tt.chain, tt.maxBeefSize)
+			if tt.setup != nil {
+				tt.setup(app)
+			}
+			resp := postSubmit(t, app, tt.topics, tt.contentType, tt.body)
+			if resp.status != tt.status || resp.body["code"] != tt.code {
+				t.Errorf("got %d %v, want %d %s", resp.status, resp.body["code"], tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestSubmitTopicsHeader(t *testing.T) {
+	beef := plainBeef(t)
+	for _, topics := range []string{"", "tm_OpNS"} {
+		if resp := postSubmit(t, newSubmitApp(t, true, len(beef)), topics, fiber.MIMEOctetStream, beef); resp.status != fiber.StatusBadRequest {
+			t.Errorf("x-topics %q: status %d, want 400", topics, resp.status)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/bsvhackathon/GorillaPool/backend/opns"
+)
+
+func runSpends(ctx context.Context, a *app.App, args []string) error {
+	tracker := &ingest.SpendTracker{
+		Topics:  a.Topics(),
+		Redis:   a.Redis,
+		Backoff: ingest.DefaultBackoff,
+		// Only name outputs move; claim contracts are spent by claims the
+		// subscription already delivers.
+		Track: func(ctx context.Context, outpoint *overlay.Outpoint) (bool, error) {
+			for _, root := range a.Roots {
+				if events, err := a.Redis.SMembers(ctx, root.Namespace+opns.OutpointEventsKey(outpoint)).Result(); err != nil {
+					return false, err
+				} else {
+					for _, event := range events {
+						if strings.HasPrefix(event, "opns:") {
+							return true, nil
+						}
+					}
+				}
+			}
+			return false, nil
+		},
+	}
+	fs := flag.NewFlagSet("spends", flag.ContinueOnError)
+	fs.IntVar(&tracker.Workers, "workers", 4, "Concurrent spend checks")
+	fs.Float64Var(&tracker.Rate, "rate", 10, "Spend lookups per second, 0 for no limit")
+	fs.DurationVar(&tracker.Interval, "interval", 10*time.Minute, "Wait before checking an unspent output again")
+	fs.DurationVar(&tracker.SweepInterval, "sweep", time.Hour, "How often new outputs are swept into the queue")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var err error
+	if tracker.Engine, err = a.Engine(); err != nil {
+		return err
+	} else if tracker.Source, err = a.Source(); err != nil {
+		return err
+	}
+	return tracker.Run(ctx)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bsvhackathon/GorillaPool/backend/app"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+// subscription is one feed into a queue. Progress is checkpointed in the
+// "progress" hash under Name, which defaults to ID. Fields left out of a
+// config file take the flag values.
+type subscription struct {
+	Name      string `json:"name"`
+	ID        string `json:"id"`
+	Source    string `json:"source"`
+	From      uint32 `json:"from"`
+	Queue     string `json:"queue"`
+	QueueSize uint32 `json:"queueSize"`
+	LiteMode  bool   `json:"liteMode"`
+	Mempool   bool   `json:"mempool"`
+}
+
+// loadSubscriptions reads a config file of subscriptions, each defaulting to
+// the flag values.
+func loadSubscriptions(path string, defaults subscription) ([]*subscription, error) {
+	var entries []json.RawMessage
+	if data, err := os.ReadFile(path); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	subs := make([]*subscription, 0, len(entries))
+	for _, entry := range entries {
+		s := defaults
+		if err := json.Unmarshal(entry, &s); err != nil {
+			return nil, err
+		}
+		subs = append(subs, &s)
+	}
+	return subs, nil
+}
+
+func runSubscribe(ctx context.Context, a *app.App, args []string) error {
+	var sub subscription
+	var config string
+	var fromBlock, queueSize uint
+	fs := flag.NewFlagSet("subscribe", flag.ContinueOnError)
+	fs.StringVar(&config, "config", "", "JSON file with a list of subscriptions; overrides the single subscription flags")
+	fs.StringVar(&sub.ID, "sub", "408a5b6f79b151ad67d1c3a2f84256ca074c78faf31e64a0cab8e9707f360b37", "Subscription ID")
+	fs.StringVar(&sub.Source, "source", a.Config.IngestSource, "Ingest source")
+	fs.UintVar(&fromBlock, "from", 800000, "Block to start from when there is no checkpoint")
+	fs.StringVar(&sub.Queue, "queue", "opns", "Queue the transactions are added to")
+	fs.UintVar(&queueSize, "queue-size", 10000000, "JungleBus client queue size")
+	fs.BoolVar(&sub.LiteMode, "lite", true, "Receive txids only")
+	fs.BoolVar(&sub.Mempool, "mempool", false, "Also queue mempool transactions")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	sub.From = uint32(fromBlock)
+	sub.QueueSize = uint32(queueSize)
+
+	subs := []*subscription{&sub}
+	if config != "" {
+		var err error
+		if subs, err = loadSubscriptions(config, sub); err != nil {
+			return err
+		}
+	}
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		if s.Name == "" {
+			s.Name = s.ID
+		}
+		src, err := ingest.New(s.Source)
+		if err != nil {
+			return err
+		}
+		if jb, ok := src.(*ingest.JungleBus); ok {
+			jb.QueueSize = s.QueueSize
+			jb.LiteMode = s.LiteMode
+			jb.Mempool = s.Mempool
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSubscription(ctx, a.Redis, src, s)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// run keeps s subscribed until ctx is done, resubscribing from its
+// checkpoint with backoff whenever the subscription drops.
+func runSubscription(ctx context.Context, rdb *redis.Client, src ingest.Source, s *subscription) {
+	backoff := ingest.DefaultBackoff
+	delay := backoff.Initial
+	for {
+		fromBlock := s.From
+		if progress, err := rdb.HGet(ctx, "progress", s.Name).Uint64(); err == nil {
+			fromBlock = uint32(progress)
+		} else if err != redis.Nil && ctx.Err() == nil {
+			log.Printf("[%s] Failed to read progress: %v", s.Name, err)
+		}
+
+		txcount := 0
+		log.Printf("[%s] Subscribing to %s from block %d", s.Name, s.ID, fromBlock)
+		err := src.Subscribe(ctx, s.ID, fromBlock, &ingest.Handler{
+			OnTransaction: func(tx *ingest.Tx) error {
+				txcount++
+				log.Printf("[%s] [TX]: %d - %d: %s\n", s.Name, tx.BlockHeight, tx.BlockIdx, tx.Txid)
+				return rdb.ZAdd(ctx, s.Queue, redis.Z{
+					Member: tx.Txid,
+					Score:  float64(tx.BlockHeight)*1e9 + float64(tx.BlockIdx),
+				}).Err()
+			},
+			OnBlockDone: func(height uint32) error {
+				log.Printf("[%s] [BLOCK]: %d %d processed\n", s.Name, height, txcount)
+				txcount = 0
+				delay = backoff.Initial
+				return rdb.HSet(ctx, "progress", s.Name, height+1).Err()
+			},
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[%s] Subscription dropped, reconnecting in %v: %v", s.Name, delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > backoff.Max {
+			delay = backoff.Max
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ingest
+
+import (
+	"context"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// BuildBeef loads txid and its inputs into atomic BEEF. Unmined parents are
+// followed back until every branch ends in a transaction with a merkle path.
+func BuildBeef(ctx context.Context, src Source, txid *chainhash.Hash) ([]byte, error) {
+	tx, err := LoadTx(ctx, src, txid)
+	if err != nil {
+		return nil, err
+	}
+	beef := &transaction.Beef{
+		Version:      transaction.BEEF_V2,
+		Transactions: map[string]*transaction.BeefTx{},
+	}
+	loaded := map[string]*transaction.Transaction{txid.String(): tx}
+	var loadInputs func(tx *transaction.Transaction) error
+	loadInputs = func(tx *transaction.Transaction) error {
+		for _, input := range tx.Inputs {
+			if source, ok := loaded[input.SourceTXID.String()]; ok {
+				input.SourceTransaction = source
+			} else if source, err := LoadTx(ctx, src, input.SourceTXID); err != nil {
+				return err
+			} else {
+				loaded[input.SourceTXID.String()] = source
+				input.SourceTransaction = source
+				if source.MerklePath == nil {
+					if err := loadInputs(source); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}
+	if err := loadInputs(tx); err != nil {
+		return nil, err
+	}
+	for _, loadedTx := range loaded {
+		if _, err := beef.MergeTransaction(loadedTx); err != nil {
+			return nil, err
+		}
+	}
+	return beef.AtomicBytes(txid)
+}
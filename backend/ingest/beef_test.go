@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+func TestLoadTx(t *testing.T) {
+	c := newFixtureChain()
+	f := NewFile(c.writeDir(t))
+	ctx := context.Background()
+	if tx, err := LoadTx(ctx, f, c.mined.TxID()); err != nil {
+		t.Fatal(err)
+	} else if !tx.TxID().Equal(*c.mined.TxID()) {
+		t.Errorf("loaded %s, want %s", tx.TxID(), c.mined.TxID())
+	} else if tx.MerklePath == nil || tx.MerklePath.BlockHeight != 101 {
+		t.Errorf("mined tx loaded without its proof")
+	}
+	if tx, err := LoadTx(ctx, f, c.child.TxID()); err != nil {
+		t.Fatal(err)
+	} else if tx.MerklePath != nil {
+		t.Errorf("unmined tx loaded with a proof")
+	}
+	if _, err := LoadTx(ctx, f, &chainhash.Hash{0x01}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing tx: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBuildBeef(t *testing.T) {
+	c := newFixtureChain()
+	ctx := context.Background()
+	for name, src := range map[string]Source{
+		"file": NewFile(c.writeDir(t)),
+		"rest": NewREST(newRESTServer(t, c).URL),
+	} {
+		beefBytes, err := BuildBeef(ctx, src, c.child.TxID())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		beef, tx, txid, err := transaction.ParseBeef(beefBytes)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		} else if !txid.Equal(*c.child.TxID()) {
+			t.Fatalf("%s: beef is of %s, want %s", name, txid, c.child.TxID())
+		}
+		// Every unmined ancestor is included, down to the mined ones.
+		for _, want := range c.txs() {
+			if beef.FindTransaction(want.TxID().String()) == nil {
+				t.Errorf("%s: beef is missing %s", name, want.TxID())
+			}
+		}
+		pending := tx.Inputs[0].SourceTransaction
+		if pending == nil || !pending.TxID().Equal(*c.pending.TxID()) || pending.MerklePath != nil {
+			t.Fatalf("%s: child's parent is not the unmined pending tx", name)
+		}
+		for _, input := range pending.Inputs {
+			if input.SourceTransaction == nil || input.SourceTransaction.MerklePath == nil {
+				t.Errorf("%s: pending input %s:%d is not proven", name, input.SourceTXID, input.SourceTxOutIndex)
+			}
+		}
+	}
+}
+
+func TestBuildBeefMissingParent(t *testing.T) {
+	c := newFixtureChain()
+	c.coinbase.MerklePath = nil
+	if _, err := BuildBeef(context.Background(), NewREST(newRESTServer(t, c).URL), c.mined.TxID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound for the coinbase's missing parent", err)
+	}
+}
@@ -0,0 +1,82 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// Cache wraps a source, keeping recently fetched transactions and proofs in
+// memory so parents shared by many children are only fetched once. Entries
+// are kept serialized so callers never share mutable transactions.
+type Cache struct {
+	Source
+	size   int
+	mu     sync.Mutex
+	raw    map[chainhash.Hash][]byte
+	proofs map[chainhash.Hash][]byte
+	order  []chainhash.Hash
+}
+
+func NewCache(src Source, size int) *Cache {
+	return &Cache{
+		Source: src,
+		size:   size,
+		raw:    make(map[chainhash.Hash][]byte, size),
+		proofs: make(map[chainhash.Hash][]byte, size),
+	}
+}
+
+func (c *Cache) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	c.mu.Lock()
+	rawtx, ok := c.raw[*txid]
+	c.mu.Unlock()
+	if ok {
+		return rawtx, nil
+	}
+	rawtx, err := c.Source.RawTx(ctx, txid)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.raw[*txid]; !ok {
+		c.evict()
+		c.raw[*txid] = rawtx
+		c.order = append(c.order, *txid)
+	}
+	return rawtx, nil
+}
+
+// Proof caches only mined transactions; an unmined one is asked again next
+// time.
+func (c *Cache) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	c.mu.Lock()
+	proof, ok := c.proofs[*txid]
+	c.mu.Unlock()
+	if ok {
+		return transaction.NewMerklePathFromBinary(proof)
+	}
+	merklePath, err := c.Source.Proof(ctx, txid)
+	if err != nil || merklePath == nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.raw[*txid]; ok {
+		c.proofs[*txid] = merklePath.Bytes()
+	}
+	return merklePath, nil
+}
+
+// evict drops the oldest entries until there is room for one more. Callers
+// hold mu.
+func (c *Cache) evict() {
+	for len(c.order) > 0 && len(c.order) >= c.size {
+		delete(c.raw, c.order[0])
+		delete(c.proofs, c.order[0])
+		c.order = c.order[1:]
+	}
+}
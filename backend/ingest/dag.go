@@ -0,0 +1,237 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// Processor submits a batch of transactions, running independent branches
+// concurrently while never submitting a transaction before a parent in the
+// same batch has been submitted.
+//
+// Transient failures are retried with Backoff. Without OnFailure the first
+// failure stops the batch. With it, a failed transaction and every
+// descendant in the batch are handed to OnFailure and the rest carry on.
+type Processor struct {
+	Source    Source
+	Workers   int
+	Backoff   Backoff
+	Submit    func(ctx context.Context, txid *chainhash.Hash, beef []byte) error
+	OnFailure func(ctx context.Context, txid *chainhash.Hash, attempts int, err error)
+}
+
+type node struct {
+	txid     *chainhash.Hash
+	err      error
+	parents  int
+	children []*node
+}
+
+// Process builds the dependency graph of txids and submits it. It stops at
+// the first error, after in-flight submissions have returned.
+func (p *Processor) Process(ctx context.Context, txids []*chainhash.Hash) error {
+	nodes := make(map[chainhash.Hash]*node, len(txids))
+	order := make([]*node, 0, len(txids))
+	for _, txid := range txids {
+		if _, ok := nodes[*txid]; !ok {
+			n := &node{txid: txid}
+			nodes[*txid] = n
+			order = append(order, n)
+		}
+	}
+
+	inputs := make([][]*chainhash.Hash, len(order))
+	if err := p.parallel(ctx, len(order), func(i int) error {
+		var rawtx []byte
+		if _, err := p.Backoff.Retry(ctx, func() (err error) {
+			rawtx, err = p.Source.RawTx(ctx, order[i].txid)
+			return err
+		}); err != nil {
+			return p.loadFailed(order[i], err)
+		} else if tx, err := transaction.NewTransactionFromBytes(rawtx); err != nil {
+			return p.loadFailed(order[i], err)
+		} else {
+			for _, input := range tx.Inputs {
+				inputs[i] = append(inputs[i], input.SourceTXID)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for i, n := range order {
+		linked := make(map[chainhash.Hash]struct{}, len(inputs[i]))
+		for _, sourceTxid := range inputs[i] {
+			if _, ok := linked[*sourceTxid]; ok {
+				continue
+			} else if parent, ok := nodes[*sourceTxid]; ok && parent != n {
+				linked[*sourceTxid] = struct{}{}
+				parent.children = append(parent.children, n)
+				n.parents++
+			}
+		}
+	}
+	return p.run(ctx, order)
+}
+
+type result struct {
+	node     *node
+	attempts int
+	err      error
+}
+
+func (p *Processor) run(ctx context.Context, order []*node) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ready := make(chan *node, len(order))
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for range p.workers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range ready {
+				attempts, err := 0, ctx.Err()
+				if err == nil && n.err != nil {
+					err = n.err
+				} else if err == nil {
+					attempts, err = p.Backoff.Retry(ctx, func() error {
+						return p.submit(ctx, n.txid)
+					})
+				}
+				results <- result{n, attempts, err}
+			}
+		}()
+	}
+
+	inflight := 0
+	for _, n := range order {
+		if n.parents == 0 {
+			ready <- n
+			inflight++
+		}
+	}
+	submitted := 0
+	var firstErr error
+	for inflight > 0 {
+		r := <-results
+		inflight--
+		if r.err != nil && p.OnFailure != nil && ctx.Err() == nil {
+			p.OnFailure(ctx, r.node.txid, r.attempts, r.err)
+			submitted += 1 + p.block(ctx, r.node, r.err)
+			continue
+		} else if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+				cancel()
+			}
+			continue
+		}
+		submitted++
+		if firstErr != nil {
+			continue
+		}
+		for _, child := range r.node.children {
+			if child.parents--; child.parents == 0 {
+				ready <- child
+				inflight++
+			}
+		}
+	}
+	close(ready)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	} else if submitted < len(order) {
+		return fmt.Errorf("%d transactions have unresolvable dependencies", len(order)-submitted)
+	}
+	return nil
+}
+
+// loadFailed records a transaction that could not be loaded. It is failed
+// when its turn comes if failures are being handled, otherwise the batch is
+// abandoned.
+func (p *Processor) loadFailed(n *node, err error) error {
+	n.err = classified(n.txid.String(), ClassInvalid, err)
+	if p.OnFailure != nil {
+		return nil
+	}
+	return n.err
+}
+
+// block fails the descendants of n, returning how many there were.
+func (p *Processor) block(ctx context.Context, n *node, cause error) int {
+	blocked := 0
+	for _, child := range n.children {
+		if child.parents == -1 {
+			continue
+		}
+		child.parents = -1
+		blocked++
+		p.OnFailure(ctx, child.txid, 0, &TxError{
+			Txid:  child.txid.String(),
+			Class: ClassBlocked,
+			Err:   fmt.Errorf("ancestor failed: %w", cause),
+		})
+		blocked += p.block(ctx, child, cause)
+	}
+	return blocked
+}
+
+func (p *Processor) submit(ctx context.Context, txid *chainhash.Hash) error {
+	if beef, err := BuildBeef(ctx, p.Source, txid); err != nil {
+		return classified(txid.String(), ClassInvalid, err)
+	} else {
+		return classified(txid.String(), ClassRejected, p.Submit(ctx, txid, beef))
+	}
+}
+
+func (p *Processor) workers() int {
+	if p.Workers < 1 {
+		return 1
+	}
+	return p.Workers
+}
+
+// parallel calls fn for 0..n-1 on the worker pool, returning the first error.
+func (p *Processor) parallel(ctx context.Context, n int, fn func(i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for range p.workers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// submissions records the order transactions are submitted in.
+type submissions struct {
+	sync.Mutex
+	order []chainhash.Hash
+	// fail is refused by submit.
+	fail *chainhash.Hash
+}
+
+func (s *submissions) submit(ctx context.Context, txid *chainhash.Hash, beef []byte) error {
+	if _, err := transaction.NewTransactionFromBEEF(beef); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.order = append(s.order, *txid)
+	if s.fail != nil && txid.Equal(*s.fail) {
+		return errors.New("refused")
+	}
+	return nil
+}
+
+func (s *submissions) index(txid *chainhash.Hash) int {
+	s.Lock()
+	defer s.Unlock()
+	for i, submitted := range s.order {
+		if submitted.Equal(*txid) {
+			return i
+		}
+	}
+	return -1
+}
+
+// batch lists the chain's txids after the coinbase, children first. The
+// coinbase is left out as its input cannot be loaded into BEEF.
+func (c *fixtureChain) batch() []*chainhash.Hash {
+	return []*chainhash.Hash{c.child.TxID(), c.pending.TxID(), c.mined.TxID()}
+}
+
+func TestProcessorSubmitsParentsFirst(t *testing.T) {
+	c := newFixtureChain()
+	source := NewFile(c.writeDir(t))
+	for range 20 {
+		s := &submissions{}
+		p := &Processor{Source: source, Workers: 4, Submit: s.submit}
+		if err := p.Process(context.Background(), c.batch()); err != nil {
+			t.Fatal(err)
+		} else if len(s.order) != len(c.batch()) {
+			t.Fatalf("submitted %d transactions, want %d", len(s.order), len(c.batch()))
+		}
+		for _, tx := range c.txs() {
+			for _, input := range tx.Inputs {
+				if parent := s.index(input.SourceTXID); parent >= 0 && parent > s.index(tx.TxID()) {
+					t.Errorf("%s was submitted before its parent %s", tx.TxID(), input.SourceTXID)
+				}
+			}
+		}
+	}
+}
+
+func TestProcessorBlocksDescendants(t *testing.T) {
+	c := newFixtureChain()
+	missing := &chainhash.Hash{0x01}
+	s := &submissions{fail: c.mined.TxID()}
+	var mu sync.Mutex
+	failures := map[chainhash.Hash]Class{}
+	p := &Processor{
+		Source:  NewFile(c.writeDir(t)),
+		Workers: 4,
+		Submit:  s.submit,
+		OnFailure: func(ctx context.Context, txid *chainhash.Hash, attempts int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failures[*txid] = Classify(err)
+		},
+	}
+	if err := p.Process(context.Background(), append(c.batch(), missing)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		txid *chainhash.Hash
+		want Class
+	}{
+		{c.mined.TxID(), ClassRejected},
+		{c.pending.TxID(), ClassBlocked},
+		{c.child.TxID(), ClassBlocked},
+		{missing, ClassInvalid},
+	} {
+		if class, ok := failures[*tt.txid]; !ok {
+			t.Errorf("%s did not fail", tt.txid)
+		} else if class != tt.want {
+			t.Errorf("%s failed as %s, want %s", tt.txid, class, tt.want)
+		}
+	}
+	for _, txid := range []*chainhash.Hash{c.pending.TxID(), c.child.TxID()} {
+		if s.index(txid) >= 0 {
+			t.Errorf("blocked %s was submitted", txid)
+		}
+	}
+}
+
+func TestProcessorStopsAtFailure(t *testing.T) {
+	c := newFixtureChain()
+	s := &submissions{fail: c.mined.TxID()}
+	p := &Processor{Source: NewFile(c.writeDir(t)), Workers: 4, Submit: s.submit}
+	err := p.Process(context.Background(), c.batch())
+	if class := Classify(err); err == nil || class != ClassRejected {
+		t.Fatalf("got %v (%s), want a rejection", err, class)
+	}
+	for _, txid := range []*chainhash.Hash{c.pending.TxID(), c.child.TxID()} {
+		if s.index(txid) >= 0 {
+			t.Errorf("%s was submitted after its parent failed", txid)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Class says what went wrong with a transaction and so whether it is worth
+// trying again.
+type Class string
+
+var (
+	// ClassTransient is a network or provider failure; retry it.
+	ClassTransient Class = "transient"
+	// ClassInvalid is a transaction, or an ancestor, that cannot be loaded or
+	// parsed.
+	ClassInvalid Class = "invalid"
+	// ClassRejected is a transaction the engine refused.
+	ClassRejected Class = "rejected"
+	// ClassBlocked is a transaction skipped because an ancestor failed.
+	ClassBlocked Class = "blocked"
+)
+
+// TxError is a failure processing a transaction.
+type TxError struct {
+	Txid  string
+	Class Class
+	Err   error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Txid, e.Class, e.Err)
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// classified wraps err in a TxError. Transient errors stay transient;
+// anything else takes class.
+func classified(txid string, class Class, err error) error {
+	if err == nil {
+		return nil
+	} else if Classify(err) == ClassTransient {
+		class = ClassTransient
+	}
+	return &TxError{Txid: txid, Class: class, Err: err}
+}
+
+// Classify reports the class of err. Errors not otherwise recognised are
+// taken to be invalid data.
+func Classify(err error) Class {
+	var txErr *TxError
+	var netErr net.Error
+	if errors.As(err, &txErr) {
+		return txErr.Class
+	} else if errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.As(err, &netErr) {
+		return ClassTransient
+	}
+	return ClassInvalid
+}
+
+// Backoff retries transient failures, doubling the delay from Initial up to
+// Max, at most Attempts times in all.
+type Backoff struct {
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+var DefaultBackoff = Backoff{
+	Attempts: 8,
+	Initial:  time.Second,
+	Max:      2 * time.Minute,
+}
+
+// Retry calls fn until it succeeds, fails with a non-transient error, the
+// attempts run out or ctx is done. It returns the last error and the number
+// of attempts made.
+func (b Backoff) Retry(ctx context.Context, fn func() error) (int, error) {
+	delay := b.Initial
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= b.Attempts || Classify(err) != ClassTransient {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
+
+// DeadLetterKey is the hash of transactions given up on, keyed by txid.
+var DeadLetterKey = "dead"
+
+// DeadLetter records why a transaction was given up on.
+type DeadLetter struct {
+	Txid     string    `json:"txid"`
+	Queue    string    `json:"queue"`
+	Score    float64   `json:"score"`
+	Class    Class     `json:"class"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Failed   time.Time `json:"failed"`
+}
+
+// Bury moves txid from queue to the dead-letter set, keeping its score so it
+// can be requeued in place.
+func Bury(ctx context.Context, rdb *redis.Client, queue string, txid string, attempts int, err error) error {
+	score, zerr := rdb.ZScore(ctx, queue, txid).Result()
+	if zerr != nil && zerr != redis.Nil {
+		return zerr
+	}
+	return BuryScored(ctx, rdb, queue, txid, score, attempts, err)
+}
+
+// BuryScored records txid in the dead-letter set to be requeued to queue at
+// score, for transactions that failed before ever being queued.
+func BuryScored(ctx context.Context, rdb *redis.Client, queue string, txid string, score float64, attempts int, err error) error {
+	dead := &DeadLetter{
+		Txid:     txid,
+		Queue:    queue,
+		Score:    score,
+		Class:    Classify(err),
+		Error:    err.Error(),
+		Attempts: attempts,
+		Failed:   time.Now(),
+	}
+	if data, err := json.Marshal(dead); err != nil {
+		return err
+	} else {
+		_, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.HSet(ctx, DeadLetterKey, txid, data)
+			p.ZRem(ctx, queue, txid)
+			return nil
+		})
+		return err
+	}
+}
+
+// DeadLetters lists the dead-letter set.
+func DeadLetters(ctx context.Context, rdb *redis.Client) ([]*DeadLetter, error) {
+	entries, err := rdb.HGetAll(ctx, DeadLetterKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	dead := make([]*DeadLetter, 0, len(entries))
+	for _, data := range entries {
+		d := &DeadLetter{}
+		if err := json.Unmarshal([]byte(data), d); err != nil {
+			return nil, err
+		}
+		dead = append(dead, d)
+	}
+	return dead, nil
+}
+
+// Requeue returns dead letters to the queues they came from.
+func Requeue(ctx context.Context, rdb *redis.Client, dead ...*DeadLetter) error {
+	_, err := rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, d := range dead {
+			p.ZAdd(ctx, d.Queue, redis.Z{Member: d.Txid, Score: d.Score})
+			p.HDel(ctx, DeadLetterKey, d.Txid)
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,142 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// File replays chain data from a directory with no network access:
+//
+//	tx/<txid>       raw transaction bytes
+//	proof/<txid>    BUMP bytes, for mined transactions
+//	sub/<name>      one "<height> <idx> <txid>" line per transaction of the
+//	                subscription <name>, height 0 for mempool
+//
+// Spends are found by indexing the inputs of every transaction under tx/.
+type File struct {
+	Dir       string
+	spendOnce sync.Once
+	spends    map[string]*chainhash.Hash
+	spendErr  error
+}
+
+func NewFile(dir string) *File {
+	return &File{Dir: dir}
+}
+
+func (f *File) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	if rawtx, err := os.ReadFile(filepath.Join(f.Dir, "tx", txid.String())); os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else {
+		return rawtx, err
+	}
+}
+
+func (f *File) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	if bump, err := os.ReadFile(filepath.Join(f.Dir, "proof", txid.String())); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		return transaction.NewMerklePathFromBinary(bump)
+	}
+}
+
+func (f *File) indexSpends() {
+	f.spends = make(map[string]*chainhash.Hash)
+	entries, err := os.ReadDir(filepath.Join(f.Dir, "tx"))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		f.spendErr = err
+		return
+	}
+	for _, entry := range entries {
+		if rawtx, err := os.ReadFile(filepath.Join(f.Dir, "tx", entry.Name())); err != nil {
+			f.spendErr = err
+			return
+		} else if tx, err := transaction.NewTransactionFromBytes(rawtx); err != nil {
+			f.spendErr = fmt.Errorf("%s: %w", entry.Name(), err)
+			return
+		} else {
+			txid := tx.TxID()
+			for _, input := range tx.Inputs {
+				outpoint := &overlay.Outpoint{
+					Txid:        *input.SourceTXID,
+					OutputIndex: input.SourceTxOutIndex,
+				}
+				f.spends[outpoint.String()] = txid
+			}
+		}
+	}
+}
+
+func (f *File) Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error) {
+	f.spendOnce.Do(f.indexSpends)
+	if f.spendErr != nil {
+		return nil, f.spendErr
+	}
+	return f.spends[outpoint.String()], nil
+}
+
+// Subscribe replays the subscription file in block order and returns once
+// every transaction has been delivered.
+func (f *File) Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *Handler) error {
+	file, err := os.Open(filepath.Join(f.Dir, "sub", subscription))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var txs []*Tx
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tx := &Tx{}
+		if _, err := fmt.Sscanf(line, "%d %d %s", &tx.BlockHeight, &tx.BlockIdx, &tx.Txid); err != nil {
+			return fmt.Errorf("invalid subscription line %q: %w", line, err)
+		}
+		if tx.BlockHeight == 0 || tx.BlockHeight >= fromBlock {
+			txs = append(txs, tx)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	slices.SortStableFunc(txs, func(a, b *Tx) int {
+		if a.BlockHeight == 0 && b.BlockHeight != 0 {
+			return 1
+		} else if a.BlockHeight != 0 && b.BlockHeight == 0 {
+			return -1
+		} else if a.BlockHeight != b.BlockHeight {
+			return int(a.BlockHeight) - int(b.BlockHeight)
+		}
+		return int(a.BlockIdx) - int(b.BlockIdx)
+	})
+	for i, tx := range txs {
+		if err := ctx.Err(); err != nil {
+			return nil
+		} else if err := handler.OnTransaction(tx); err != nil {
+			return err
+		}
+		last := i == len(txs)-1 || txs[i+1].BlockHeight != tx.BlockHeight
+		if last && tx.BlockHeight > 0 && handler.OnBlockDone != nil {
+			if err := handler.OnBlockDone(tx.BlockHeight); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+)
+
+func TestFileRawTxAndProof(t *testing.T) {
+	c := newFixtureChain()
+	f := NewFile(c.writeDir(t))
+	ctx := context.Background()
+	for _, tx := range c.txs() {
+		if rawtx, err := f.RawTx(ctx, tx.TxID()); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(rawtx, tx.Bytes()) {
+			t.Errorf("%s: raw tx does not match", tx.TxID())
+		}
+		proof, err := f.Proof(ctx, tx.TxID())
+		if err != nil {
+			t.Fatal(err)
+		} else if (proof == nil) != (tx.MerklePath == nil) {
+			t.Errorf("%s: got proof %v, want %v", tx.TxID(), proof != nil, tx.MerklePath != nil)
+		} else if proof != nil && !bytes.Equal(proof.Bytes(), tx.MerklePath.Bytes()) {
+			t.Errorf("%s: proof does not match", tx.TxID())
+		}
+	}
+	if _, err := f.RawTx(ctx, &chainhash.Hash{0x01}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing tx: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileSpend(t *testing.T) {
+	c := newFixtureChain()
+	f := NewFile(c.writeDir(t))
+	ctx := context.Background()
+	for _, tt := range []struct {
+		outpoint *overlay.Outpoint
+		want     *chainhash.Hash
+	}{
+		{&overlay.Outpoint{Txid: *c.coinbase.TxID(), OutputIndex: 0}, c.mined.TxID()},
+		{&overlay.Outpoint{Txid: *c.coinbase.TxID(), OutputIndex: 1}, c.pending.TxID()},
+		{&overlay.Outpoint{Txid: *c.pending.TxID(), OutputIndex: 0}, c.child.TxID()},
+		{&overlay.Outpoint{Txid: *c.child.TxID(), OutputIndex: 0}, nil},
+	} {
+		if spend, err := f.Spend(ctx, tt.outpoint); err != nil {
+			t.Fatal(err)
+		} else if (spend == nil) != (tt.want == nil) || spend != nil && !spend.Equal(*tt.want) {
+			t.Errorf("%s: spent by %v, want %v", tt.outpoint, spend, tt.want)
+		}
+	}
+}
+
+func TestFileSubscribe(t *testing.T) {
+	c := newFixtureChain()
+	f := NewFile(c.writeDir(t))
+	for _, tt := range []struct {
+		from uint32
+		want []string
+		done []uint32
+	}{{
+		from: 0,
+		want: []string{c.coinbase.TxID().String(), c.mined.TxID().String(), c.pending.TxID().String(), c.child.TxID().String()},
+		done: []uint32{100, 101},
+	}, {
+		from: 101,
+		want: []string{c.mined.TxID().String(), c.pending.TxID().String(), c.child.TxID().String()},
+		done: []uint32{101},
+	}} {
+		var got []string
+		var done []uint32
+		if err := f.Subscribe(context.Background(), "all", tt.from, &Handler{
+			OnTransaction: func(tx *Tx) error {
+				got = append(got, tx.Txid)
+				return nil
+			},
+			OnBlockDone: func(height uint32) error {
+				done = append(done, height)
+				return nil
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !equal(got, tt.want) {
+			t.Errorf("from %d: delivered %v, want %v", tt.from, got, tt.want)
+		}
+		if !equal(done, tt.done) {
+			t.Errorf("from %d: blocks done %v, want %v", tt.from, done, tt.done)
+		}
+	}
+}
+
+func equal[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
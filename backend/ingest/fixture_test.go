@@ -0,0 +1,220 @@
+package ingest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// fixtureChain is a small chain: coinbase is mined at 100, mined spends it
+// at 101, pending spends both and child spends pending in the mempool.
+type fixtureChain struct {
+	coinbase, mined, pending, child *transaction.Transaction
+	// blocks maps the block hash of each mined transaction to its height.
+	blocks map[string]uint32
+	// dummy is the other leaf of each two transaction block.
+	dummy *chainhash.Hash
+}
+
+var fixtureScript, _ = script.NewFromHex("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+
+func spend(sources ...*transaction.Transaction) *transaction.Transaction {
+	tx := transaction.NewTransaction()
+	for _, source := range sources {
+		tx.AddInput(&transaction.TransactionInput{
+			SourceTXID:       source.TxID(),
+			SourceTxOutIndex: 0,
+			UnlockingScript:  script.NewFromBytes([]byte{script.OpTRUE}),
+			SequenceNumber:   0xffffffff,
+		})
+	}
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: fixtureScript, Satoshis: 1000})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: fixtureScript, Satoshis: 1})
+	return tx
+}
+
+func newFixtureChain() *fixtureChain {
+	c := &fixtureChain{
+		blocks: map[string]uint32{},
+		dummy:  &chainhash.Hash{0xdd},
+	}
+	c.coinbase = transaction.NewTransaction()
+	c.coinbase.AddInput(&transaction.TransactionInput{
+		SourceTXID:       &chainhash.Hash{},
+		SourceTxOutIndex: 0xffffffff,
+		UnlockingScript:  script.NewFromBytes([]byte{0x01, 0x64}),
+		SequenceNumber:   0xffffffff,
+	})
+	c.coinbase.AddOutput(&transaction.TransactionOutput{LockingScript: fixtureScript, Satoshis: 5000})
+	c.coinbase.AddOutput(&transaction.TransactionOutput{LockingScript: fixtureScript, Satoshis: 5000})
+	c.mined = spend(c.coinbase)
+	c.pending = spend(c.mined)
+	c.pending.AddInput(&transaction.TransactionInput{
+		SourceTXID:       c.coinbase.TxID(),
+		SourceTxOutIndex: 1,
+		UnlockingScript:  script.NewFromBytes([]byte{script.OpTRUE}),
+		SequenceNumber:   0xffffffff,
+	})
+	c.child = spend(c.pending)
+
+	// The coinbase is leaf 0 of block 100 and mined is leaf 1 of block 101.
+	c.coinbase.MerklePath = c.path(100, 0, c.coinbase.TxID())
+	c.mined.MerklePath = c.path(101, 1, c.mined.TxID())
+	for _, tx := range []*transaction.Transaction{c.coinbase, c.mined} {
+		root, err := tx.MerklePath.ComputeRoot(tx.TxID())
+		if err != nil {
+			panic(err)
+		}
+		c.blocks[root.String()] = tx.MerklePath.BlockHeight
+	}
+	return c
+}
+
+func (c *fixtureChain) path(height uint32, offset uint64, txid *chainhash.Hash) *transaction.MerklePath {
+	isTxid := true
+	leaves := []*transaction.PathElement{
+		{Offset: offset, Hash: txid, Txid: &isTxid},
+		{Offset: offset ^ 1, Hash: c.dummy},
+	}
+	if offset == 1 {
+		leaves[0], leaves[1] = leaves[1], leaves[0]
+	}
+	return transaction.NewMerklePath(height, [][]*transaction.PathElement{leaves})
+}
+
+// leafIndex is the position of a mined transaction in its block.
+func leafIndex(tx *transaction.Transaction) uint64 {
+	for _, leaf := range tx.MerklePath.Path[0] {
+		if leaf.Hash.Equal(*tx.TxID()) {
+			return leaf.Offset
+		}
+	}
+	return 0
+}
+
+func (c *fixtureChain) txs() []*transaction.Transaction {
+	return []*transaction.Transaction{c.coinbase, c.mined, c.pending, c.child}
+}
+
+// writeDir lays the chain out as a File source, with a subscription "all"
+// of every transaction.
+func (c *fixtureChain) writeDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, sub := range []string{"tx", "proof", "sub"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var lines []string
+	for _, tx := range c.txs() {
+		txid := tx.TxID().String()
+		if err := os.WriteFile(filepath.Join(dir, "tx", txid), tx.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		height, idx := uint32(0), uint64(0)
+		if tx.MerklePath != nil {
+			height, idx = tx.MerklePath.BlockHeight, leafIndex(tx)
+			if err := os.WriteFile(filepath.Join(dir, "proof", txid), tx.MerklePath.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%d %d %s", height, idx, txid))
+	}
+	// Mined lines listed out of order, after a comment, to be sorted on
+	// replay. Mempool lines are replayed in the order listed.
+	lines[0], lines[1] = lines[1], lines[0]
+	data := "# fixture\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "sub", "all"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// restServer serves the chain as a WhatsOnChain-style API. History is the
+// address history returned for every address, and tip the chain height;
+// both can be changed between polls.
+type restServer struct {
+	*httptest.Server
+	chain *fixtureChain
+	mu    sync.Mutex
+	// history and tip are what /address/<a>/history and /chain/info return.
+	history []*historyItem
+	tip     uint32
+	// status, when set, is returned for every request.
+	status int
+}
+
+func newRESTServer(t *testing.T, c *fixtureChain) *restServer {
+	s := &restServer{chain: c}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *restServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	txs := map[string]*transaction.Transaction{}
+	for _, tx := range s.chain.txs() {
+		txs[tx.TxID().String()] = tx
+	}
+	switch {
+	case len(parts) == 2 && parts[0] == "chain" && parts[1] == "info":
+		json.NewEncoder(w).Encode(&chainInfo{Blocks: s.tip})
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "history":
+		json.NewEncoder(w).Encode(s.history)
+	case len(parts) == 3 && parts[0] == "block" && parts[1] == "hash":
+		if height, ok := s.chain.blocks[parts[2]]; ok {
+			json.NewEncoder(w).Encode(&blockInfo{Height: height})
+		} else {
+			http.NotFound(w, r)
+		}
+	case len(parts) == 3 && parts[0] == "tx" && parts[2] == "hex":
+		if tx, ok := txs[parts[1]]; ok {
+			fmt.Fprintf(w, "%q", hex.EncodeToString(tx.Bytes()))
+		} else {
+			http.NotFound(w, r)
+		}
+	case len(parts) == 4 && parts[0] == "tx" && parts[2] == "proof" && parts[3] == "tsc":
+		if tx, ok := txs[parts[1]]; !ok || tx.MerklePath == nil {
+			http.NotFound(w, r)
+		} else {
+			root, _ := tx.MerklePath.ComputeRoot(tx.TxID())
+			json.NewEncoder(w).Encode([]*tscProof{{
+				Index:  leafIndex(tx),
+				TxOrId: parts[1],
+				Target: root.String(),
+				Nodes:  []string{s.chain.dummy.String()},
+			}})
+		}
+	case len(parts) == 4 && parts[0] == "tx" && parts[3] == "spent":
+		for _, tx := range s.chain.txs() {
+			for vin, input := range tx.Inputs {
+				if input.SourceTXID.String() == parts[1] && fmt.Sprint(input.SourceTxOutIndex) == parts[2] {
+					json.NewEncoder(w).Encode(&spentInfo{Txid: tx.TxID().String(), Vin: uint32(vin)})
+					return
+				}
+			}
+		}
+		http.NotFound(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
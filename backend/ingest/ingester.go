@@ -0,0 +1,166 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/redis/go-redis/v9"
+)
+
+// CheckpointKey holds, per topic, the next block to ingest.
+var CheckpointKey = "progress"
+
+// Ingester feeds a subscription straight into the engine. Mempool
+// transactions are submitted as they are seen; once mined, transactions
+// already applied only have their merkle proof handed to the engine.
+// Failing transactions are retried with Backoff and then buried, to be
+// requeued to Queue, so one bad transaction does not stall the rest.
+type Ingester struct {
+	Source       Source
+	Engine       *engine.Engine
+	Topics       []string
+	Subscription string
+	FromBlock    uint32
+	Checkpoints  *redis.Client
+	Backoff      Backoff
+	// Queue is the queue buried transactions are requeued to; "opns" if
+	// empty.
+	Queue string
+}
+
+// Checkpoint returns the block to resume from, the lowest of the topics'
+// checkpoints so no topic misses a block.
+func (i *Ingester) Checkpoint(ctx context.Context) (uint32, error) {
+	from := uint32(0)
+	for n, topic := range i.Topics {
+		block := i.FromBlock
+		if progress, err := i.Checkpoints.HGet(ctx, CheckpointKey, topic).Uint64(); err == nil {
+			block = uint32(progress)
+		} else if err != redis.Nil {
+			return 0, err
+		}
+		if n == 0 || block < from {
+			from = block
+		}
+	}
+	return from, nil
+}
+
+func (i *Ingester) saveCheckpoint(ctx context.Context, height uint32) error {
+	_, err := i.Checkpoints.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, topic := range i.Topics {
+			if err := p.HSet(ctx, CheckpointKey, topic, height+1).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (i *Ingester) applied(ctx context.Context, txid *chainhash.Hash) (bool, error) {
+	for _, topic := range i.Topics {
+		if exists, err := i.Engine.Storage.DoesAppliedTransactionExist(ctx, &overlay.AppliedTransaction{
+			Txid:  txid,
+			Topic: topic,
+		}); err != nil || !exists {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Ingest submits a single transaction.
+func (i *Ingester) Ingest(ctx context.Context, tx *Tx) error {
+	txid, err := chainhash.NewHashFromHex(tx.Txid)
+	if err != nil {
+		return err
+	}
+	if applied, err := i.applied(ctx, txid); err != nil {
+		return err
+	} else if applied {
+		if tx.BlockHeight == 0 {
+			return nil
+		} else if proof, err := i.Source.Proof(ctx, txid); err != nil || proof == nil {
+			return err
+		} else {
+			return i.Engine.HandleNewMerkleProof(ctx, txid, proof)
+		}
+	}
+	mode := engine.SubmitModeHistorical
+	if tx.BlockHeight == 0 {
+		mode = engine.SubmitModeCurrent
+	}
+	if beef, err := BuildBeef(ctx, i.Source, txid); err != nil {
+		return classified(tx.Txid, ClassInvalid, err)
+	} else if admit, err := i.Engine.Submit(ctx, overlay.TaggedBEEF{
+		Beef:   beef,
+		Topics: i.Topics,
+	}, mode, nil); err != nil {
+		return classified(tx.Txid, ClassRejected, err)
+	} else {
+		for topic, instructions := range admit {
+			if len(instructions.OutputsToAdmit) > 0 {
+				log.Printf("[%s] %s %d: admitted %v", topic, tx.Txid, tx.BlockHeight, instructions.OutputsToAdmit)
+			}
+		}
+		return nil
+	}
+}
+
+// Run subscribes from the checkpoint and ingests until ctx is done or the
+// source is exhausted. A subscription that fails is resubscribed from the
+// checkpoint with backoff.
+func (i *Ingester) Run(ctx context.Context) error {
+	backoff := i.Backoff
+	if backoff.Attempts == 0 {
+		backoff = DefaultBackoff
+	}
+	queue := i.Queue
+	if queue == "" {
+		queue = "opns"
+	}
+	delay := backoff.Initial
+	for {
+		from, err := i.Checkpoint(ctx)
+		if err == nil {
+			log.Printf("Ingesting %s into %v from block %d", i.Subscription, i.Topics, from)
+			err = i.Source.Subscribe(ctx, i.Subscription, from, &Handler{
+				OnTransaction: func(tx *Tx) error {
+					attempts, err := backoff.Retry(ctx, func() error {
+						return i.Ingest(ctx, tx)
+					})
+					if err == nil || ctx.Err() != nil {
+						return err
+					}
+					log.Printf("Giving up on %s after %d attempts: %v", tx.Txid, attempts, err)
+					score := float64(tx.BlockHeight)*1e9 + float64(tx.BlockIdx)
+					return BuryScored(ctx, i.Checkpoints, queue, tx.Txid, score, attempts, err)
+				},
+				OnBlockDone: func(height uint32) error {
+					delay = backoff.Initial
+					return i.saveCheckpoint(ctx, height)
+				},
+			})
+			if err == nil {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("Subscription %s dropped, resubscribing in %v: %v", i.Subscription, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > backoff.Max {
+			delay = backoff.Max
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ingest
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/GorillaPool/go-junglebus"
+	"github.com/GorillaPool/go-junglebus/models"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// JungleBus reads from a JungleBus server. Subscriptions are JungleBus
+// subscription IDs.
+type JungleBus struct {
+	URL       string
+	QueueSize uint32
+	LiteMode  bool
+	Mempool   bool
+	client    *junglebus.Client
+}
+
+func NewJungleBus(url string) (*JungleBus, error) {
+	if client, err := junglebus.New(
+		junglebus.WithHTTP(url),
+	); err != nil {
+		return nil, err
+	} else {
+		return &JungleBus{
+			URL:       url,
+			QueueSize: 10000000,
+			LiteMode:  true,
+			Mempool:   true,
+			client:    client,
+		}, nil
+	}
+}
+
+func (j *JungleBus) Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+		cancel()
+	}
+	onTx := func(txn *models.TransactionResponse) {
+		if err := handler.OnTransaction(&Tx{
+			Txid:        txn.Id,
+			BlockHeight: txn.BlockHeight,
+			BlockIdx:    txn.BlockIndex,
+		}); err != nil {
+			fail(err)
+		}
+	}
+	onMempool := onTx
+	if !j.Mempool {
+		onMempool = nil
+	}
+	sub, err := j.client.SubscribeWithQueue(ctx,
+		subscription,
+		uint64(fromBlock),
+		0,
+		junglebus.EventHandler{
+			OnTransaction: onTx,
+			OnMempool:     onMempool,
+			OnStatus: func(status *models.ControlResponse) {
+				switch status.StatusCode {
+				case 200:
+					if handler.OnBlockDone != nil {
+						if err := handler.OnBlockDone(status.Block); err != nil {
+							fail(err)
+						}
+					}
+				case 999:
+					fail(fmt.Errorf("%w: %s", ErrSubscriptionEnded, status.Message))
+				}
+			},
+			OnError: func(err error) {
+				fail(fmt.Errorf("%w: %w", ErrUnavailable, err))
+			},
+		},
+		&junglebus.SubscribeOptions{
+			QueueSize: j.QueueSize,
+			LiteMode:  j.LiteMode,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	<-ctx.Done()
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// get reads path from the JungleBus API. A 404 is reported as ErrNotFound,
+// and rate limits, server errors and failed requests as ErrUnavailable.
+func (j *JungleBus) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w: %w", path, ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%s: %s: %w", path, resp.Status, ErrUnavailable)
+	} else if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (j *JungleBus) transaction(ctx context.Context, txid *chainhash.Hash) (*models.Transaction, error) {
+	txn := &models.Transaction{}
+	if body, err := j.get(ctx, "/v1/transaction/get/"+txid.String()); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(body, txn); err != nil {
+		return nil, err
+	}
+	return txn, nil
+}
+
+func (j *JungleBus) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	if txn, err := j.transaction(ctx, txid); err != nil {
+		return nil, err
+	} else if len(txn.Transaction) == 0 {
+		return nil, ErrNotFound
+	} else {
+		return txn.Transaction, nil
+	}
+}
+
+func (j *JungleBus) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	if txn, err := j.transaction(ctx, txid); err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if len(txn.MerkleProof) == 0 {
+		return nil, nil
+	} else {
+		return transaction.NewMerklePathFromBinary(txn.MerkleProof)
+	}
+}
+
+func (j *JungleBus) Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error) {
+	if spend, err := j.get(ctx, "/v1/txo/spend/"+outpoint.OrdinalString()); err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if len(spend) == 0 {
+		return nil, nil
+	} else {
+		return chainhash.NewHashFromHex(hex.EncodeToString(spend))
+	}
+}
@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GorillaPool/go-junglebus/models"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+)
+
+func newJungleBusServer(t *testing.T, c *fixtureChain, status *int) *JungleBus {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *status != 0 {
+			w.WriteHeader(*status)
+			return
+		}
+		for _, tx := range c.txs() {
+			if r.URL.Path == "/v1/transaction/get/"+tx.TxID().String() {
+				txn := &models.Transaction{Transaction: tx.Bytes()}
+				if tx.MerklePath != nil {
+					txn.MerkleProof = tx.MerklePath.Bytes()
+				}
+				json.NewEncoder(w).Encode(txn)
+				return
+			} else if r.URL.Path == "/v1/txo/spend/"+tx.TxID().String()+"_0" && tx == c.coinbase {
+				// The spending txid is sent in display byte order.
+				spend, _ := hex.DecodeString(c.mined.TxID().String())
+				w.Write(spend)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(s.Close)
+	j, err := NewJungleBus(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestJungleBusLookups(t *testing.T) {
+	c := newFixtureChain()
+	status := 0
+	j := newJungleBusServer(t, c, &status)
+	ctx := context.Background()
+	if rawtx, err := j.RawTx(ctx, c.child.TxID()); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(rawtx, c.child.Bytes()) {
+		t.Errorf("raw tx does not match")
+	}
+	if proof, err := j.Proof(ctx, c.mined.TxID()); err != nil {
+		t.Fatal(err)
+	} else if proof == nil || proof.BlockHeight != 101 {
+		t.Errorf("mined tx has no proof")
+	}
+	if proof, err := j.Proof(ctx, c.child.TxID()); err != nil || proof != nil {
+		t.Errorf("unmined tx: got %v, %v, want no proof", proof, err)
+	}
+	if spend, err := j.Spend(ctx, &overlay.Outpoint{Txid: *c.coinbase.TxID(), OutputIndex: 0}); err != nil {
+		t.Fatal(err)
+	} else if spend == nil || !spend.Equal(*c.mined.TxID()) {
+		t.Errorf("spent by %v, want %s", spend, c.mined.TxID())
+	}
+	if spend, err := j.Spend(ctx, &overlay.Outpoint{Txid: *c.child.TxID(), OutputIndex: 0}); err != nil || spend != nil {
+		t.Errorf("unspent output: got %v, %v", spend, err)
+	}
+	if _, err := j.RawTx(ctx, &chainhash.Hash{0x01}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing tx: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestJungleBusUnavailable(t *testing.T) {
+	c := newFixtureChain()
+	status := 0
+	j := newJungleBusServer(t, c, &status)
+	ctx := context.Background()
+	outpoint := &overlay.Outpoint{Txid: *c.child.TxID(), OutputIndex: 0}
+	for _, status = range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		if _, err := j.RawTx(ctx, c.child.TxID()); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%d: raw tx got %v, want ErrUnavailable", status, err)
+		}
+		if _, err := j.Proof(ctx, c.child.TxID()); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%d: proof got %v, want ErrUnavailable", status, err)
+		}
+		if _, err := j.Spend(ctx, outpoint); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%d: spend got %v, want ErrUnavailable", status, err)
+		}
+	}
+	status = http.StatusBadRequest
+	if _, err := j.RawTx(ctx, c.child.TxID()); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Errorf("400: got %v, want a permanent error", err)
+	}
+	j.URL = "http://127.0.0.1:1"
+	if _, err := j.RawTx(ctx, c.child.TxID()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("unreachable: got %v, want ErrUnavailable", err)
+	}
+}
@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// REST reads from a WhatsOnChain-style API rooted at URL, for example
+// https://api.whatsonchain.com/v1/bsv/main. Subscriptions are to an address
+// and are polled.
+type REST struct {
+	URL          string
+	Client       *http.Client
+	PollInterval time.Duration
+}
+
+func NewREST(url string) *REST {
+	return &REST{
+		URL:          strings.TrimSuffix(url, "/"),
+		Client:       http.DefaultClient,
+		PollInterval: 30 * time.Second,
+	}
+}
+
+type tscProof struct {
+	Index  uint64   `json:"index"`
+	TxOrId string   `json:"txOrId"`
+	Target string   `json:"target"`
+	Nodes  []string `json:"nodes"`
+}
+
+type historyItem struct {
+	TxHash string `json:"tx_hash"`
+	Height int64  `json:"height"`
+}
+
+type chainInfo struct {
+	Blocks uint32 `json:"blocks"`
+}
+
+type blockInfo struct {
+	Height uint32 `json:"height"`
+}
+
+type spentInfo struct {
+	Txid string `json:"txid"`
+	Vin  uint32 `json:"vin"`
+}
+
+// get reads path into out, or returns the body when out is nil. A 404 is
+// reported as ErrNotFound.
+func (r *REST) get(ctx context.Context, path string, out any) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	} else if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("%s: %s: %w", path, resp.Status, ErrUnavailable)
+	} else if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	} else if out != nil {
+		return body, json.Unmarshal(body, out)
+	}
+	return body, nil
+}
+
+func (r *REST) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	if body, err := r.get(ctx, fmt.Sprintf("/tx/%s/hex", txid), nil); err != nil {
+		return nil, err
+	} else {
+		return hex.DecodeString(strings.Trim(string(body), "\" \t\n\r"))
+	}
+}
+
+// Proof converts the TSC proof of txid into a merkle path.
+func (r *REST) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	var proofs []*tscProof
+	if _, err := r.get(ctx, fmt.Sprintf("/tx/%s/proof/tsc", txid), &proofs); err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if len(proofs) == 0 || proofs[0] == nil {
+		return nil, nil
+	}
+	proof := proofs[0]
+	var block blockInfo
+	if _, err := r.get(ctx, "/block/hash/"+proof.Target, &block); err != nil {
+		return nil, err
+	}
+	isTxid := true
+	isDuplicate := true
+	path := make([][]*transaction.PathElement, len(proof.Nodes))
+	for level, node := range proof.Nodes {
+		offset := proof.Index >> level
+		sibling := &transaction.PathElement{Offset: offset ^ 1}
+		if node == "*" {
+			sibling.Duplicate = &isDuplicate
+		} else if hash, err := chainhash.NewHashFromHex(node); err != nil {
+			return nil, err
+		} else {
+			sibling.Hash = hash
+		}
+		path[level] = []*transaction.PathElement{sibling}
+		if level == 0 {
+			leaf := &transaction.PathElement{
+				Offset: offset,
+				Hash:   txid,
+				Txid:   &isTxid,
+			}
+			path[level] = append(path[level], leaf)
+			slices.SortFunc(path[level], func(a, b *transaction.PathElement) int {
+				return int(a.Offset) - int(b.Offset)
+			})
+		}
+	}
+	return transaction.NewMerklePath(block.Height, path), nil
+}
+
+func (r *REST) Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error) {
+	var spent spentInfo
+	if _, err := r.get(ctx, fmt.Sprintf("/tx/%s/%d/spent", outpoint.Txid.String(), outpoint.OutputIndex), &spent); err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if spent.Txid == "" {
+		return nil, nil
+	} else {
+		return chainhash.NewHashFromHex(spent.Txid)
+	}
+}
+
+// restSeenDepth is how many blocks back Subscribe remembers delivered
+// transactions. Older ones are skipped by height instead.
+const restSeenDepth = 6
+
+// Subscribe polls the history of the address subscription. Mempool
+// transactions are delivered with height 0 and again once mined.
+func (r *REST) Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *Handler) error {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	seen := make(map[string]uint32)
+	from := fromBlock
+	for {
+		var info chainInfo
+		var history []*historyItem
+		// Cancelling mid-poll ends the subscription as it does between polls.
+		if _, err := r.get(ctx, "/chain/info", &info); ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		} else if _, err := r.get(ctx, fmt.Sprintf("/address/%s/history", subscription), &history); ctx.Err() != nil {
+			return nil
+		} else if err != nil && err != ErrNotFound {
+			return err
+		}
+		slices.SortStableFunc(history, func(a, b *historyItem) int {
+			if a.Height <= 0 && b.Height > 0 {
+				return 1
+			} else if a.Height > 0 && b.Height <= 0 {
+				return -1
+			}
+			return int(a.Height - b.Height)
+		})
+		pending := make(map[string]struct{})
+		for _, item := range history {
+			height := uint32(0)
+			if item.Height > 0 {
+				height = uint32(item.Height)
+			} else {
+				pending[item.TxHash] = struct{}{}
+			}
+			if height > 0 && height < from {
+				continue
+			} else if prev, ok := seen[item.TxHash]; ok && prev == height {
+				continue
+			}
+			seen[item.TxHash] = height
+			if err := handler.OnTransaction(&Tx{
+				Txid:        item.TxHash,
+				BlockHeight: height,
+			}); err != nil {
+				return err
+			}
+		}
+		if handler.OnBlockDone != nil && info.Blocks >= fromBlock {
+			if err := handler.OnBlockDone(info.Blocks); err != nil {
+				return err
+			}
+		}
+		// Forget transactions mined below the depth kept, and mempool
+		// transactions that have left the history.
+		if info.Blocks > restSeenDepth {
+			from = max(from, info.Blocks-restSeenDepth+1)
+		}
+		for txid, height := range seen {
+			if _, ok := pending[txid]; height > 0 && height < from || height == 0 && !ok {
+				delete(seen, txid)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
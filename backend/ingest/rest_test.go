@@ -0,0 +1,134 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+)
+
+func TestRESTRawTxAndProof(t *testing.T) {
+	c := newFixtureChain()
+	r := NewREST(newRESTServer(t, c).URL)
+	ctx := context.Background()
+	for _, tx := range c.txs() {
+		if rawtx, err := r.RawTx(ctx, tx.TxID()); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(rawtx, tx.Bytes()) {
+			t.Errorf("%s: raw tx does not match", tx.TxID())
+		}
+		proof, err := r.Proof(ctx, tx.TxID())
+		if err != nil {
+			t.Fatal(err)
+		} else if tx.MerklePath == nil {
+			if proof != nil {
+				t.Errorf("%s: unmined tx has a proof", tx.TxID())
+			}
+			continue
+		} else if proof == nil {
+			t.Fatalf("%s: mined tx has no proof", tx.TxID())
+		}
+		want, _ := tx.MerklePath.ComputeRoot(tx.TxID())
+		if root, err := proof.ComputeRoot(tx.TxID()); err != nil {
+			t.Fatal(err)
+		} else if !root.Equal(*want) {
+			t.Errorf("%s: proof root %s, want %s", tx.TxID(), root, want)
+		} else if proof.BlockHeight != tx.MerklePath.BlockHeight {
+			t.Errorf("%s: proof height %d, want %d", tx.TxID(), proof.BlockHeight, tx.MerklePath.BlockHeight)
+		}
+	}
+	if _, err := r.RawTx(ctx, &chainhash.Hash{0x01}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing tx: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRESTSpend(t *testing.T) {
+	c := newFixtureChain()
+	r := NewREST(newRESTServer(t, c).URL)
+	ctx := context.Background()
+	if spend, err := r.Spend(ctx, &overlay.Outpoint{Txid: *c.coinbase.TxID(), OutputIndex: 1}); err != nil {
+		t.Fatal(err)
+	} else if spend == nil || !spend.Equal(*c.pending.TxID()) {
+		t.Errorf("spent by %v, want %s", spend, c.pending.TxID())
+	}
+	if spend, err := r.Spend(ctx, &overlay.Outpoint{Txid: *c.child.TxID(), OutputIndex: 0}); err != nil {
+		t.Fatal(err)
+	} else if spend != nil {
+		t.Errorf("unspent output spent by %s", spend)
+	}
+}
+
+func TestRESTUnavailable(t *testing.T) {
+	c := newFixtureChain()
+	s := newRESTServer(t, c)
+	r := NewREST(s.URL)
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway} {
+		s.status = status
+		if _, err := r.RawTx(context.Background(), c.child.TxID()); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%d: got %v, want ErrUnavailable", status, err)
+		}
+	}
+	s.status = http.StatusBadRequest
+	if _, err := r.RawTx(context.Background(), c.child.TxID()); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Errorf("400: got %v, want a permanent error", err)
+	}
+}
+
+// TestRESTSubscribe polls as the fixture chain is mined, checking each
+// transaction is delivered once per height even after it is forgotten.
+func TestRESTSubscribe(t *testing.T) {
+	c := newFixtureChain()
+	s := newRESTServer(t, c)
+	r := NewREST(s.URL)
+	r.PollInterval = time.Millisecond
+
+	coinbase, mined, pending := c.coinbase.TxID().String(), c.mined.TxID().String(), c.pending.TxID().String()
+	polls := []struct {
+		tip     uint32
+		history []*historyItem
+	}{
+		{100, []*historyItem{{coinbase, 100}, {mined, 0}}},
+		{101, []*historyItem{{coinbase, 100}, {mined, 101}, {pending, 0}}},
+		{101, []*historyItem{{coinbase, 100}, {mined, 101}, {pending, 0}}},
+		// Far enough on that the coinbase is only skipped by height.
+		{120, []*historyItem{{coinbase, 100}, {mined, 101}}},
+		{121, []*historyItem{{coinbase, 100}, {mined, 101}}},
+	}
+	want := []Tx{{Txid: coinbase, BlockHeight: 100}, {Txid: mined}, {Txid: mined, BlockHeight: 101}, {Txid: pending}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []Tx
+	poll := 0
+	next := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if poll == len(polls) {
+			cancel()
+			return
+		}
+		s.tip, s.history = polls[poll].tip, polls[poll].history
+		poll++
+	}
+	next()
+	if err := r.Subscribe(ctx, "addr", 100, &Handler{
+		OnTransaction: func(tx *Tx) error {
+			got = append(got, *tx)
+			return nil
+		},
+		OnBlockDone: func(height uint32) error {
+			next()
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
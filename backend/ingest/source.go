@@ -0,0 +1,85 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// ErrUnavailable marks a provider error worth retrying, such as a rate limit
+// or server error.
+var ErrUnavailable = errors.New("source unavailable")
+
+// ErrSubscriptionEnded is returned by Subscribe when the provider closes the
+// subscription. Resubscribing from the last checkpoint picks it up again.
+var ErrSubscriptionEnded = errors.New("subscription ended")
+
+// Tx is a transaction delivered by a subscription. BlockHeight is 0 for
+// mempool transactions.
+type Tx struct {
+	Txid        string
+	BlockHeight uint32
+	BlockIdx    uint64
+}
+
+// Handler receives subscription events. An error from OnTransaction ends the
+// subscription. OnBlockDone is called once every transaction up to and
+// including height has been delivered.
+type Handler struct {
+	OnTransaction func(tx *Tx) error
+	OnBlockDone   func(height uint32) error
+}
+
+// Source is a provider of chain data.
+type Source interface {
+	// Subscribe delivers the transactions matching subscription, a provider
+	// specific topic or address, from fromBlock on. It blocks until ctx is
+	// done, the source is exhausted, or an error occurs.
+	Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *Handler) error
+	// RawTx returns the serialized transaction, or ErrNotFound.
+	RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error)
+	// Proof returns the merkle path of a mined transaction, or nil while it is
+	// unmined.
+	Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error)
+	// Spend returns the txid spending outpoint, or nil while it is unspent.
+	Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error)
+}
+
+// LoadTx fetches a transaction with its merkle path attached when mined.
+func LoadTx(ctx context.Context, src Source, txid *chainhash.Hash) (*transaction.Transaction, error) {
+	if rawtx, err := src.RawTx(ctx, txid); err != nil {
+		return nil, err
+	} else if tx, err := transaction.NewTransactionFromBytes(rawtx); err != nil {
+		return nil, err
+	} else if tx.MerklePath, err = src.Proof(ctx, txid); err != nil {
+		return nil, err
+	} else {
+		return tx, nil
+	}
+}
+
+// New builds a source from a spec of the form "junglebus:<url>",
+// "rest:<url>" or "file:<dir>".
+func New(spec string) (Source, error) {
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid source %q", spec)
+	}
+	switch kind {
+	case "junglebus":
+		return NewJungleBus(target)
+	case "rest":
+		return NewREST(target), nil
+	case "file":
+		return NewFile(target), nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", kind)
+	}
+}
@@ -0,0 +1,268 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsvhackathon/GorillaPool/backend/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// SpendQueueKey is the work queue of tracked outpoints, scored by when each
+// is next due to be checked.
+var SpendQueueKey = "spq"
+
+// SpendProgressKey holds the tracker's counters and last sweep time.
+var SpendProgressKey = "spq:progress"
+
+// SpendTracker follows unspent outputs of Topics wherever they go. Outputs
+// are swept into a work queue, each due one is asked of the source for its
+// spend, and spending transactions are submitted to the engine, whose new
+// outputs are tracked in turn.
+type SpendTracker struct {
+	Source  Source
+	Engine  *engine.Engine
+	Topics  []string
+	Redis   *redis.Client
+	Workers int
+	// Rate caps spend lookups per second.
+	Rate float64
+	// Interval is how long an unspent outpoint waits before it is checked
+	// again.
+	Interval time.Duration
+	// SweepInterval is how often topic outputs are swept into the queue.
+	SweepInterval time.Duration
+	Backoff       Backoff
+	// Track, when set, limits which outputs are queued.
+	Track func(ctx context.Context, outpoint *overlay.Outpoint) (bool, error)
+}
+
+// Run sweeps and works the queue until ctx is done.
+func (t *SpendTracker) Run(ctx context.Context) error {
+	if err := t.Sweep(ctx); err != nil {
+		return err
+	}
+	if t.SweepInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(t.SweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := t.Sweep(ctx); err != nil && ctx.Err() == nil {
+						log.Printf("Spend sweep failed: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
+	var limit <-chan time.Time
+	if t.Rate > 0 {
+		limiter := time.NewTicker(time.Duration(float64(time.Second) / t.Rate))
+		defer limiter.Stop()
+		limit = limiter.C
+	} else {
+		unlimited := make(chan time.Time)
+		close(unlimited)
+		limit = unlimited
+	}
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range max(t.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for outpoint := range jobs {
+				select {
+				case <-ctx.Done():
+					continue
+				case <-limit:
+				}
+				if err := t.check(ctx, outpoint); err != nil && ctx.Err() == nil {
+					log.Printf("Spend check of %s failed: %v", outpoint, err)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for {
+		due, err := t.Redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:     SpendQueueKey,
+			Start:   "-inf",
+			Stop:    time.Now().Unix(),
+			ByScore: true,
+			Count:   1000,
+		}).Result()
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// Lease the batch so it is not picked up again while being worked.
+		for _, outpoint := range due {
+			if err := t.reschedule(ctx, outpoint); err != nil {
+				return err
+			}
+		}
+		for _, outpoint := range due {
+			select {
+			case <-ctx.Done():
+				return nil
+			case jobs <- outpoint:
+			}
+		}
+		if len(due) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// Sweep queues every unspent output of the topics not already queued.
+func (t *SpendTracker) Sweep(ctx context.Context) error {
+	now := float64(time.Now().Unix())
+	for _, topic := range t.Topics {
+		outpoints, err := t.Redis.ZRange(ctx, storage.OutMembershipKey(topic), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(outpoints); start += 1000 {
+			batch := outpoints[start:min(start+1000, len(outpoints))]
+			spent := make([]*redis.StringCmd, len(batch))
+			if _, err := t.Redis.Pipelined(ctx, func(p redis.Pipeliner) error {
+				for i, outpointStr := range batch {
+					if outpoint, err := overlay.NewOutpointFromString(outpointStr); err != nil {
+						return err
+					} else {
+						spent[i] = p.HGet(ctx, storage.OutputTopicKey(outpoint, topic), "sp")
+					}
+				}
+				return nil
+			}); err != nil && err != redis.Nil {
+				return err
+			}
+			queue := make([]redis.Z, 0, len(batch))
+			for i, outpointStr := range batch {
+				outpoint, _ := overlay.NewOutpointFromString(outpointStr)
+				if isSpent, _ := spent[i].Bool(); isSpent {
+					continue
+				} else if track, err := t.tracked(ctx, outpoint); err != nil {
+					return err
+				} else if track {
+					queue = append(queue, redis.Z{Member: outpointStr, Score: now})
+				}
+			}
+			if len(queue) > 0 {
+				if err := t.Redis.ZAddNX(ctx, SpendQueueKey, queue...).Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return t.Redis.HSet(ctx, SpendProgressKey, "swept", time.Now().Unix()).Err()
+}
+
+func (t *SpendTracker) tracked(ctx context.Context, outpoint *overlay.Outpoint) (bool, error) {
+	if t.Track == nil {
+		return true, nil
+	}
+	return t.Track(ctx, outpoint)
+}
+
+func (t *SpendTracker) isSpent(ctx context.Context, outpoint *overlay.Outpoint) (bool, error) {
+	for _, topic := range t.Topics {
+		if spent, err := t.Redis.HGet(ctx, storage.OutputTopicKey(outpoint, topic), "sp").Bool(); err == redis.Nil {
+			continue
+		} else if err != nil {
+			return false, err
+		} else if spent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *SpendTracker) reschedule(ctx context.Context, outpoint string) error {
+	return t.Redis.ZAddXX(ctx, SpendQueueKey, redis.Z{
+		Member: outpoint,
+		Score:  float64(time.Now().Add(t.Interval).Unix()),
+	}).Err()
+}
+
+func (t *SpendTracker) check(ctx context.Context, outpointStr string) error {
+	outpoint, err := overlay.NewOutpointFromString(outpointStr)
+	if err != nil {
+		return t.Redis.ZRem(ctx, SpendQueueKey, outpointStr).Err()
+	}
+	if spent, err := t.isSpent(ctx, outpoint); err != nil {
+		return err
+	} else if spent {
+		return t.Redis.ZRem(ctx, SpendQueueKey, outpointStr).Err()
+	}
+
+	t.Redis.HIncrBy(ctx, SpendProgressKey, "checked", 1)
+	var txid *chainhash.Hash
+	if _, err := t.Backoff.Retry(ctx, func() (err error) {
+		txid, err = t.Source.Spend(ctx, outpoint)
+		return err
+	}); err != nil {
+		t.reschedule(ctx, outpointStr)
+		return err
+	} else if txid == nil {
+		return t.reschedule(ctx, outpointStr)
+	}
+
+	var admit overlay.Steak
+	if attempts, err := t.Backoff.Retry(ctx, func() error {
+		if beef, err := BuildBeef(ctx, t.Source, txid); err != nil {
+			return classified(txid.String(), ClassInvalid, err)
+		} else if admit, err = t.Engine.Submit(ctx, overlay.TaggedBEEF{
+			Beef:   beef,
+			Topics: t.Topics,
+		}, engine.SubmitModeHistorical, nil); err != nil {
+			return classified(txid.String(), ClassRejected, err)
+		}
+		return nil
+	}); err != nil {
+		t.reschedule(ctx, outpointStr)
+		return Bury(ctx, t.Redis, "opns", txid.String(), attempts, err)
+	}
+
+	now := float64(time.Now().Unix())
+	queue := []redis.Z{}
+	for _, instructions := range admit {
+		for _, vout := range instructions.OutputsToAdmit {
+			admitted := &overlay.Outpoint{Txid: *txid, OutputIndex: vout}
+			if track, err := t.tracked(ctx, admitted); err != nil {
+				return err
+			} else if track {
+				queue = append(queue, redis.Z{Member: admitted.String(), Score: now})
+			}
+		}
+	}
+	log.Println("Followed", outpointStr, "to", txid, "admitting", len(queue), "outputs")
+	_, err = t.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(queue) > 0 {
+			p.ZAddNX(ctx, SpendQueueKey, queue...)
+		}
+		p.ZRem(ctx, SpendQueueKey, outpointStr)
+		p.HIncrBy(ctx, SpendProgressKey, "spent", 1)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,96 @@
+package opns
+
+import (
+	"context"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/redis/go-redis/v9"
+)
+
+type AnswerFormat string
+
+var (
+	AnswerFormatBeef AnswerFormat = "beef"
+	AnswerFormatJson AnswerFormat = "json"
+)
+
+// NameOutput is the decoded form of a lookup result, for clients that only
+// need to display a name and do not want to parse transactions.
+type NameOutput struct {
+	Outpoint  string            `json:"outpoint"`
+	Domain    string            `json:"domain,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	OwnerType OwnerType         `json:"ownerType,omitempty"`
+	OwnerHash string            `json:"ownerHash,omitempty"`
+	Price     *uint64           `json:"price,omitempty"`
+	Listing   *Listing          `json:"listing,omitempty"`
+	Records   map[string]string `json:"records,omitempty"`
+	Height    uint32            `json:"height"`
+	Idx       uint64            `json:"idx"`
+	Spent     bool              `json:"spent"`
+	Beef      []byte            `json:"beef,omitempty"`
+}
+
+// atomicBeef returns the output's transaction as atomic BEEF, merged with any
+// ancillary BEEF needed to verify it.
+func atomicBeef(output *engine.Output) ([]byte, error) {
+	if beef, _, _, err := transaction.ParseBeef(output.Beef); err != nil {
+		return nil, err
+	} else {
+		if len(output.AncillaryBeef) > 0 {
+			if err = beef.MergeBeefBytes(output.AncillaryBeef); err != nil {
+				return nil, err
+			}
+		}
+		return beef.AtomicBytes(&output.Outpoint.Txid)
+	}
+}
+
+// DescribeOutputs decodes outputs from the event index. The BEEF of each
+// output is only attached when spv is set.
+func (l *LookupService) DescribeOutputs(ctx context.Context, outputs []*engine.Output, spv bool) ([]*NameOutput, error) {
+	eventCmds := make([]*redis.StringSliceCmd, len(outputs))
+	listingCmds := make([]*redis.StringCmd, len(outputs))
+	if _, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, output := range outputs {
+			eventCmds[i] = p.SMembers(ctx, l.key(OutpointEventsKey(&output.Outpoint)))
+			listingCmds[i] = p.HGet(ctx, l.key(ListingsKey), output.Outpoint.String())
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	results := make([]*NameOutput, 0, len(outputs))
+	for i, output := range outputs {
+		events, err := eventCmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		name := nameFromEvents(output.Outpoint.String(), events)
+		result := &NameOutput{
+			Outpoint:  name.Outpoint,
+			Domain:    name.Domain,
+			Owner:     name.Owner,
+			OwnerType: name.OwnerType,
+			OwnerHash: name.OwnerHash,
+			Records:   name.Records,
+			Height:    output.BlockHeight,
+			Idx:       output.BlockIdx,
+			Spent:     output.Spent,
+		}
+		if result.Listing, err = parseListing(listingCmds[i]); err != nil {
+			return nil, err
+		} else if result.Listing != nil {
+			result.Price = &result.Listing.Price
+		}
+		if spv {
+			if result.Beef, err = atomicBeef(output); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,46 @@
+package opns
+
+import (
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	feemodel "github.com/bsv-blockchain/go-sdk/transaction/fee_model"
+)
+
+// FundTx adds utxos as inputs after the existing ones, appends a change output
+// to changeScript if one is given, and sets the change so the transaction pays
+// feeRate satoshis per kilobyte. Change that would be dust is left to the
+// miner. Unlocking scripts must be signed after funding, since the change
+// amount is part of what they commit to.
+func FundTx(tx *transaction.Transaction, utxos []*transaction.UTXO, changeScript *script.Script, feeRate uint64) error {
+	if len(utxos) > 0 {
+		if err := tx.AddInputsFromUTXOs(utxos...); err != nil {
+			return err
+		}
+	}
+	if changeScript != nil {
+		tx.AddOutput(&transaction.TransactionOutput{
+			LockingScript: changeScript,
+			Change:        true,
+		})
+	}
+	if feeRate == 0 {
+		feeRate = DefaultFeeRate
+	}
+	feeModel := &feemodel.SatoshisPerKilobyte{Satoshis: feeRate}
+	if changeScript != nil {
+		return tx.Fee(feeModel, transaction.ChangeDistributionEqual)
+	}
+	// Without change outputs tx.Fee divides by zero, so the inputs are only
+	// checked to cover the outputs and fee.
+	fee, err := feeModel.ComputeFee(tx)
+	if err != nil {
+		return err
+	}
+	satsIn, err := tx.TotalInputSatoshis()
+	if err != nil {
+		return err
+	} else if satsIn < tx.TotalOutputSatoshis()+fee {
+		return transaction.ErrInsufficientInputs
+	}
+	return nil
+}
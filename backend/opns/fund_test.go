@@ -0,0 +1,73 @@
+package opns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	feemodel "github.com/bsv-blockchain/go-sdk/transaction/fee_model"
+)
+
+var fundScript, _ = script.NewFromHex("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+
+func fundingUtxo(satoshis uint64) *transaction.UTXO {
+	return &transaction.UTXO{
+		TxID:                    (&transaction.Transaction{}).TxID(),
+		LockingScript:           fundScript,
+		Satoshis:                satoshis,
+		UnlockingScriptTemplate: &unsigned{length: p2pkhUnlockLength},
+	}
+}
+
+func paymentTx(satoshis uint64) *transaction.Transaction {
+	tx := transaction.NewTransaction()
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: fundScript, Satoshis: satoshis})
+	return tx
+}
+
+func TestFundTxChange(t *testing.T) {
+	tx := paymentTx(1000)
+	if err := FundTx(tx, []*transaction.UTXO{fundingUtxo(600), fundingUtxo(600)}, fundScript, 50); err != nil {
+		t.Fatal(err)
+	} else if len(tx.Inputs) != 2 || len(tx.Outputs) != 2 || !tx.Outputs[1].Change {
+		t.Fatalf("got %d inputs and %d outputs, want 2 and a change output", len(tx.Inputs), len(tx.Outputs))
+	}
+	fee, err := (&feemodel.SatoshisPerKilobyte{Satoshis: 50}).ComputeFee(tx)
+	if err != nil {
+		t.Fatal(err)
+	} else if paid, err := tx.GetFee(); err != nil {
+		t.Fatal(err)
+	} else if paid != fee {
+		t.Errorf("paid %d, want %d", paid, fee)
+	}
+}
+
+func TestFundTxNoChange(t *testing.T) {
+	tx := paymentTx(1000)
+	if err := FundTx(tx, []*transaction.UTXO{fundingUtxo(1200)}, nil, 50); err != nil {
+		t.Fatal(err)
+	} else if len(tx.Outputs) != 1 {
+		t.Fatalf("got %d outputs, want 1", len(tx.Outputs))
+	} else if paid, err := tx.GetFee(); err != nil {
+		t.Fatal(err)
+	} else if paid != 200 {
+		t.Errorf("paid %d, want the 200 surplus", paid)
+	}
+}
+
+func TestFundTxInsufficient(t *testing.T) {
+	for _, changeScript := range []*script.Script{nil, fundScript} {
+		tx := paymentTx(1000)
+		if err := FundTx(tx, []*transaction.UTXO{fundingUtxo(1000)}, changeScript, 50); !errors.Is(err, transaction.ErrInsufficientInputs) {
+			t.Errorf("change %v: got %v, want ErrInsufficientInputs", changeScript != nil, err)
+		}
+	}
+}
+
+func TestFundTxNoInputs(t *testing.T) {
+	tx := paymentTx(0)
+	if err := FundTx(tx, nil, nil, 0); !errors.Is(err, transaction.ErrInsufficientInputs) {
+		t.Errorf("got %v, want ErrInsufficientInputs", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"slices"
 	"strings"
 	"time"
@@ -33,33 +34,58 @@ type BlockPos struct {
 	Idx    uint64 `json:"idx"`
 }
 type Question struct {
-	Event    string    `json:"event"`
-	Events   []string  `json:"events"`
-	JoinType *JoinType `json:"join"`
-	From     BlockPos  `json:"from"`
-	Limit    int       `json:"limit"`
-	Spent    *bool     `json:"spent"`
-	Reverse  bool      `json:"rev"`
+	Event    string       `json:"event"`
+	Events   []string     `json:"events"`
+	JoinType *JoinType    `json:"join"`
+	From     BlockPos     `json:"from"`
+	Limit    int          `json:"limit"`
+	Spent    *bool        `json:"spent"`
+	Reverse  bool         `json:"rev"`
+	Names    *NameQuery   `json:"names,omitempty"`
+	Format   AnswerFormat `json:"format,omitempty"`
+	SPV      bool         `json:"spv,omitempty"`
 }
 
 type LookupService struct {
 	db      *redis.Client
 	storage engine.Storage
 	topic   string
+	root    *Root
+	headers HeaderSource
+	chain   ChainSource
+	ns      string
+	shadow  bool
+}
+
+// key places a key in the service's namespace. The default root has an empty
+// namespace, other roots are prefixed by theirs, and reindexing builds a
+// shadow copy under a further prefix.
+func (l *LookupService) key(k string) string {
+	return l.ns + k
 }
 
 func EventKey(event string) string {
 	return "ev:" + event
 }
 
+// SpentKey holds spent outpoints scored by when they were spent. It replaces
+// the "ev:spent" set of earlier releases, which MigrateSpent converts.
+var SpentKey = EventKey("spends")
+
+// legacySpentKey is the set spent outpoints were kept in before SpentKey.
+var legacySpentKey = EventKey("spent")
+
 func OutpointEventsKey(outpoint *overlay.Outpoint) string {
 	return "oe:" + outpoint.String()
 }
 
-func NewLookupService(connString string, storage engine.Storage, topic string) (*LookupService, error) {
+func NewLookupService(connString string, storage engine.Storage, root *Root, headers HeaderSource) (*LookupService, error) {
 	r := &LookupService{
 		storage: storage,
-		topic:   topic,
+		topic:   root.Topic,
+		root:    root,
+		headers: headers,
+		ns:      root.Namespace,
 	}
 	if opts, err := redis.ParseURL(connString); err != nil {
 		return nil, err
@@ -72,11 +98,15 @@ func NewLookupService(connString string, storage engine.Storage, topic string) (
 func (l *LookupService) OutputAdded(ctx context.Context, outpoint *overlay.Outpoint, outputScript *script.Script, topic string, blockHeight uint32, blockIdx uint64) error {
 	events := make([]string, 0, 5)
 	var domain string
+	var owner *Owner
+	var minted bool
+	var tx *transaction.Transaction
+	var ordInput *overlay.Outpoint
 	if output, err := l.storage.FindOutput(ctx, outpoint, &l.topic, nil, true); err != nil {
 		return err
 	} else if output == nil {
 		return errors.New("output not found")
-	} else if tx, err := transaction.NewTransactionFromBEEF(output.Beef); err != nil {
+	} else if tx, err = transaction.NewTransactionFromBEEF(output.Beef); err != nil {
 		return err
 	} else {
 		satsOut := uint64(0)
@@ -90,11 +120,11 @@ func (l *LookupService) OutputAdded(ctx context.Context, outpoint *overlay.Outpo
 				satsIn += sourceOut.Satoshis
 				continue
 			} else if satsIn == satsOut {
-				outpoint := &overlay.Outpoint{
+				ordInput = &overlay.Outpoint{
 					Txid:        *input.SourceTXID,
 					OutputIndex: input.SourceTxOutIndex,
 				}
-				if inputEvents, err := l.db.SMembers(ctx, OutpointEventsKey(outpoint)).Result(); err != nil {
+				if inputEvents, err := l.db.SMembers(ctx, l.key(OutpointEventsKey(ordInput))).Result(); err != nil {
 					return err
 				} else {
 					for _, event := range inputEvents {
@@ -109,68 +139,122 @@ func (l *LookupService) OutputAdded(ctx context.Context, outpoint *overlay.Outpo
 			}
 		}
 	}
-	if o := Decode(outputScript); o != nil {
+	if o := l.root.Decode(outputScript); o != nil {
 		events = append(events, "mine:"+o.Domain)
 	} else if insc := inscription.Decode(outputScript); insc != nil && insc.File.Type == "application/op-ns" {
 		domain = string(insc.File.Content)
+		minted = true
 		events = append(events, "opns:"+domain)
-		if p := p2pkh.Decode(script.NewFromBytes(insc.ScriptPrefix), true); p != nil {
-			events = append(events, fmt.Sprintf("p2pkh:%s", p.AddressString))
-		} else if p := p2pkh.Decode(script.NewFromBytes(insc.ScriptSuffix), true); p != nil {
-			events = append(events, fmt.Sprintf("p2pkh:%s", p.AddressString))
+		if o := DecodeOwner(script.NewFromBytes(insc.ScriptPrefix)); o != nil {
+			owner = o
+		} else if o := DecodeOwner(script.NewFromBytes(insc.ScriptSuffix)); o != nil {
+			owner = o
 		}
+	} else if ol := ordlock.Decode(outputScript); ol != nil {
+		if domain != "" {
+			events = append(events, fmt.Sprintf("list:%s", domain))
+			if err := l.SaveListing(ctx, outpoint, domain, ol, blockHeight, blockIdx); err != nil {
+				return err
+			}
+		}
+	} else if p2pkh.Decode(outputScript, true) != nil || domain != "" {
+		owner = DecodeOwner(outputScript)
+	}
+	if owner != nil {
+		events = append(events, owner.Events()...)
 	}
-	if p := p2pkh.Decode(outputScript, true); p != nil {
-		events = append(events, fmt.Sprintf("p2pkh:%s", p.AddressString))
-	} else if ol := ordlock.Decode(outputScript); ol != nil && domain != "" {
-		events = append(events, fmt.Sprintf("list:%s", domain))
+	if domain != "" {
+		events = append(events, "opns")
+		for key, value := range DecodeRecords(outputScript) {
+			events = append(events, RecordEvent(key, value))
+		}
+	}
+	if ordInput != nil && domain != "" {
+		if listing, err := l.CloseListing(ctx, ordInput); err != nil {
+			return err
+		} else if listing != nil {
+			if listing.Sold(tx) {
+				var buyer string
+				if owner != nil {
+					buyer = owner.ID()
+				}
+				events = append(events, fmt.Sprintf("sale:%s", domain))
+				if err := l.SaveSale(ctx, &Sale{
+					Outpoint: outpoint.String(),
+					Listing:  listing.Outpoint,
+					Domain:   domain,
+					Price:    listing.Price,
+					Seller:   listing.Seller,
+					Buyer:    buyer,
+					Height:   blockHeight,
+					Idx:      blockIdx,
+				}); err != nil {
+					return err
+				}
+			} else {
+				events = append(events, fmt.Sprintf("delist:%s", domain))
+			}
+		}
 	}
 	l.SaveEvents(ctx, outpoint, events, blockHeight, blockIdx)
-	return nil
+	if minted {
+		if err := l.saveMint(ctx, domain, outpoint, blockHeight, blockIdx); err != nil {
+			return err
+		}
+	}
+	if domain != "" {
+		if err := l.indexName(ctx, outpoint.String(), domain, HeightScore(blockHeight, blockIdx)); err != nil {
+			return err
+		}
+	}
+	return l.recordBlock(ctx, outpoint, blockHeight)
 }
 
-func (l *LookupService) SaveEvent(ctx context.Context, outpoint *overlay.Outpoint, event string, height uint32, idx uint64) error {
-	var score float64
+// HeightScore orders confirmed outputs by block position and unconfirmed
+// outputs by the time they were seen.
+func HeightScore(height uint32, idx uint64) float64 {
 	if height > 0 {
-		score = float64(height)*1e9 + float64(idx)
-	} else {
-		score = float64(time.Now().UnixNano())
+		return float64(height)*1e9 + float64(idx)
 	}
+	return float64(time.Now().UnixNano())
+}
+
+func (l *LookupService) SaveEvent(ctx context.Context, outpoint *overlay.Outpoint, event string, height uint32, idx uint64) error {
+	score := HeightScore(height, idx)
 	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
 		op := outpoint.String()
-		if err := p.ZAdd(ctx, EventKey(event), redis.Z{
+		if err := p.ZAdd(ctx, l.key(EventKey(event)), redis.Z{
 			Score:  score,
 			Member: op,
 		}).Err(); err != nil {
 			return err
-		} else if err := p.SAdd(ctx, OutpointEventsKey(outpoint), event).Err(); err != nil {
+		} else if err := p.SAdd(ctx, l.key(OutpointEventsKey(outpoint)), event).Err(); err != nil {
 			return err
 		}
-		p.Publish(ctx, event, fmt.Sprintf("%f:%s", score, op))
+		if !l.shadow {
+			p.Publish(ctx, l.key(event), fmt.Sprintf("%f:%s", score, op))
+		}
 		return nil
 	})
 	return err
 
 }
 func (l *LookupService) SaveEvents(ctx context.Context, outpoint *overlay.Outpoint, events []string, height uint32, idx uint64) error {
-	var score float64
-	if height > 0 {
-		score = float64(height)*1e9 + float64(idx)
-	} else {
-		score = float64(time.Now().UnixNano())
-	}
+	score := HeightScore(height, idx)
 	op := outpoint.String()
 	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
 		for _, event := range events {
-			if err := p.ZAdd(ctx, EventKey(event), redis.Z{
+			if err := p.ZAdd(ctx, l.key(EventKey(event)), redis.Z{
 				Score:  score,
 				Member: op,
 			}).Err(); err != nil {
 				return err
-			} else if err := p.SAdd(ctx, OutpointEventsKey(outpoint), event).Err(); err != nil {
+			} else if err := p.SAdd(ctx, l.key(OutpointEventsKey(outpoint)), event).Err(); err != nil {
 				return err
 			}
-			p.Publish(ctx, event, op)
+			if !l.shadow {
+				p.Publish(ctx, l.key(event), op)
+			}
 		}
 		return nil
 	})
@@ -186,14 +270,22 @@ func (l *LookupService) Close() {
 func (l *LookupService) LookupOutputs(ctx context.Context, question *Question) (outputs []*engine.Output, err error) {
 	startScore := float64(question.From.Height)*1e9 + float64(question.From.Idx)
 	var ops []string
-	if len(question.Events) > 0 {
+	if question.Names != nil {
+		names, err := l.QueryNames(ctx, question.Names)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			ops = append(ops, name.Outpoint)
+		}
+	} else if len(question.Events) > 0 {
 		join := JoinTypeIntersect
 		if question.JoinType != nil {
 			join = *question.JoinType
 		}
-		keys := make([]string, len(question.Events))
+		keys := make([]string, 0, len(question.Events))
 		for _, event := range question.Events {
-			keys = append(keys, EventKey(event))
+			keys = append(keys, l.key(EventKey(event)))
 		}
 		var results []redis.Z
 		switch join {
@@ -242,7 +334,7 @@ func (l *LookupService) LookupOutputs(ctx context.Context, question *Question) (
 		}
 	} else if question.Event != "" {
 		query := redis.ZRangeArgs{
-			Key:     EventKey(question.Event),
+			Key:     l.key(EventKey(question.Event)),
 			Start:   fmt.Sprintf("(%f", startScore),
 			Stop:    "+inf",
 			ByScore: true,
@@ -281,6 +373,8 @@ func (l *LookupService) LookupOutputs(ctx context.Context, question *Question) (
 func (l *LookupService) Lookup(ctx context.Context, q *lookup.LookupQuestion) (answer *lookup.LookupAnswer, err error) {
 	question := &Question{}
 	if err := json.Unmarshal(q.Query, question); err != nil {
+		return nil, QueryErrors{{Field: "query", Message: err.Error()}}
+	} else if err := question.Validate(); err != nil {
 		return nil, err
 	}
 	outputs, err := l.LookupOutputs(ctx, question)
@@ -288,65 +382,122 @@ func (l *LookupService) Lookup(ctx context.Context, q *lookup.LookupQuestion) (a
 		return nil, err
 	}
 
+	if question.Format == AnswerFormatJson {
+		if results, err := l.DescribeOutputs(ctx, outputs, question.SPV); err != nil {
+			return nil, err
+		} else {
+			return &lookup.LookupAnswer{
+				Type:   lookup.AnswerTypeFreeform,
+				Result: results,
+			}, nil
+		}
+	}
+
 	answer = &lookup.LookupAnswer{
 		Type: lookup.AnswerTypeOutputList,
 	}
-
 	for _, output := range outputs {
-		if beef, _, _, err := transaction.ParseBeef(output.Beef); err != nil {
+		if beefBytes, err := atomicBeef(output); err != nil {
 			return nil, err
 		} else {
-			if len(output.AncillaryBeef) > 0 {
-				if err = beef.MergeBeefBytes(output.AncillaryBeef); err != nil {
-					return nil, err
-				}
-			}
-			if beefBytes, err := beef.AtomicBytes(&output.Outpoint.Txid); err != nil {
-				return nil, err
-			} else {
-				answer.Outputs = append(answer.Outputs, &lookup.OutputListItem{
-					OutputIndex: output.Outpoint.OutputIndex,
-					Beef:        beefBytes,
-				})
-			}
+			answer.Outputs = append(answer.Outputs, &lookup.OutputListItem{
+				OutputIndex: output.Outpoint.OutputIndex,
+				Beef:        beefBytes,
+			})
 		}
 	}
 	return answer, nil
 }
 
 func (l *LookupService) OutputSpent(ctx context.Context, outpoint *overlay.Outpoint, _ string) error {
-	return l.db.SAdd(ctx, EventKey("spent"), outpoint.String()).Err()
+	if err := l.DropListing(ctx, outpoint); err != nil {
+		return err
+	} else if err := l.unindexName(ctx, outpoint.String()); err != nil {
+		return err
+	}
+	return l.db.ZAdd(ctx, l.key(SpentKey), redis.Z{
+		Score:  HeightScore(0, 0),
+		Member: outpoint.String(),
+	}).Err()
 }
 
 func (l *LookupService) OutputsSpent(ctx context.Context, outpoints []*overlay.Outpoint, _ string) error {
-	args := make([]interface{}, 0, len(outpoints))
+	if len(outpoints) == 0 {
+		return nil
+	}
+	score := HeightScore(0, 0)
+	members := make([]redis.Z, 0, len(outpoints))
+	ops := make([]string, 0, len(outpoints))
 	for _, outpoint := range outpoints {
-		args = append(args, outpoint.Bytes())
+		if err := l.DropListing(ctx, outpoint); err != nil {
+			return err
+		}
+		ops = append(ops, outpoint.String())
+		members = append(members, redis.Z{
+			Score:  score,
+			Member: outpoint.String(),
+		})
+	}
+	if err := l.unindexName(ctx, ops...); err != nil {
+		return err
 	}
-	return l.db.SAdd(ctx, EventKey("spent"), args...).Err()
+	return l.db.ZAdd(ctx, l.key(SpentKey), members...).Err()
+}
+
+// MigrateSpent moves the members of the legacy spent set into SpentKey,
+// scored by the time of migration as their spend times were never kept. An
+// "admin reindex -switch" afterwards restores the true order.
+func (l *LookupService) MigrateSpent(ctx context.Context) error {
+	if kind, err := l.db.Type(ctx, l.key(legacySpentKey)).Result(); err != nil || kind != "set" {
+		return err
+	}
+	score := HeightScore(0, 0)
+	count := 0
+	iter := l.db.SScan(ctx, l.key(legacySpentKey), 0, "", 1000).Iterator()
+	for iter.Next(ctx) {
+		if err := l.db.ZAdd(ctx, l.key(SpentKey), redis.Z{
+			Score:  score,
+			Member: iter.Val(),
+		}).Err(); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	log.Printf("Migrated %d spent outpoints to %s; run admin reindex -switch to restore their order", count, l.key(SpentKey))
+	return l.db.Del(ctx, l.key(legacySpentKey)).Err()
 }
 
 func (l *LookupService) OutputDeleted(ctx context.Context, outpoint *overlay.Outpoint, topic string) error {
 	op := outpoint.String()
-	if events, err := l.db.SMembers(ctx, OutpointEventsKey(outpoint)).Result(); err != nil {
+	if _, err := l.CloseListing(ctx, outpoint); err != nil {
+		return err
+	} else if err := l.DeleteSale(ctx, outpoint); err != nil {
+		return err
+	} else if err := l.unindexName(ctx, op); err != nil {
+		return err
+	}
+	if events, err := l.db.SMembers(ctx, l.key(OutpointEventsKey(outpoint))).Result(); err != nil {
 		return err
 	} else if len(events) == 0 {
 		return nil
 	} else {
 		_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
 			for _, event := range events {
-				if err := p.ZRem(ctx, EventKey(event), op).Err(); err != nil {
+				if err := p.ZRem(ctx, l.key(EventKey(event)), op).Err(); err != nil {
 					return err
 				}
 			}
-			return p.Del(ctx, OutpointEventsKey(outpoint)).Err()
+			return p.Del(ctx, l.key(OutpointEventsKey(outpoint))).Err()
 		})
 		return err
 	}
 }
 
 func (l *LookupService) FindEvents(ctx context.Context, outpoint *overlay.Outpoint) ([]string, error) {
-	if events, err := l.db.SMembers(ctx, OutpointEventsKey(outpoint)).Result(); err != nil {
+	if events, err := l.db.SMembers(ctx, l.key(OutpointEventsKey(outpoint))).Result(); err != nil {
 		return nil, err
 	} else {
 		return events, nil
@@ -354,21 +505,33 @@ func (l *LookupService) FindEvents(ctx context.Context, outpoint *overlay.Outpoi
 }
 
 func (l *LookupService) OutputBlockHeightUpdated(ctx context.Context, outpoint *overlay.Outpoint, height uint32, idx uint64) error {
-	var score float64
-	if height > 0 {
-		score = float64(height)*1e9 + float64(idx)
-	} else {
-		score = float64(time.Now().UnixNano())
-	}
+	score := HeightScore(height, idx)
 	op := outpoint.String()
-	if events, err := l.db.SMembers(ctx, OutpointEventsKey(outpoint)).Result(); err != nil {
+	if err := l.db.ZAddXX(ctx, l.key(ListingSortKey(ListingSortRecent)), redis.Z{
+		Score:  score,
+		Member: op,
+	}).Err(); err != nil {
+		return err
+	} else if err := l.db.ZAddXX(ctx, l.key(NameIndexKey(NameSortRecent)), redis.Z{
+		Score:  score,
+		Member: op,
+	}).Err(); err != nil {
+		return err
+	} else if err := l.updateSaleHeight(ctx, outpoint, height, idx); err != nil {
+		return err
+	} else if err := l.recordBlock(ctx, outpoint, height); err != nil {
+		return err
+	} else if err := l.updateMint(ctx, outpoint, height); err != nil {
+		return err
+	}
+	if events, err := l.db.SMembers(ctx, l.key(OutpointEventsKey(outpoint))).Result(); err != nil {
 		return err
 	} else if len(events) == 0 {
 		return nil
 	} else {
 		_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
 			for _, event := range events {
-				if err := p.ZAdd(ctx, EventKey(event), redis.Z{
+				if err := p.ZAdd(ctx, l.key(EventKey(event)), redis.Z{
 					Score:  score,
 					Member: op,
 				}).Err(); err != nil {
@@ -387,6 +550,7 @@ func (l *LookupService) GetDocumentation() string {
 
 func (l *LookupService) GetMetaData() *overlay.MetaData {
 	return &overlay.MetaData{
-		Name: "Events",
+		Name:        l.root.Service,
+		Description: "Events lookup for " + l.root.Name + " names",
 	}
 }
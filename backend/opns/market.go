@@ -0,0 +1,193 @@
+package opns
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/bitcoin-sv/go-templates/template/ordlock"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/redis/go-redis/v9"
+)
+
+type ListingSort string
+
+var (
+	ListingSortPrice  ListingSort = "price"
+	ListingSortRecent ListingSort = "recent"
+	ListingSortLength ListingSort = "length"
+)
+
+var ListingsKey = "mkt:listings"
+
+func (s ListingSort) Valid() bool {
+	return s == ListingSortPrice || s == ListingSortRecent || s == ListingSortLength
+}
+
+func ListingSortKey(sort ListingSort) string {
+	return "mkt:" + string(sort)
+}
+
+type Listing struct {
+	Outpoint string `json:"outpoint"`
+	Domain   string `json:"domain"`
+	Price    uint64 `json:"price"`
+	Seller   string `json:"seller"`
+	PayOut   string `json:"payout"`
+	Height   uint32 `json:"height"`
+	Idx      uint64 `json:"idx"`
+}
+
+// Sold reports whether tx satisfies the listing's payout output, which is how
+// a purchase is told apart from the seller cancelling the listing.
+func (l *Listing) Sold(tx *transaction.Transaction) bool {
+	payout, err := hex.DecodeString(l.PayOut)
+	if err != nil {
+		return false
+	}
+	for _, output := range tx.Outputs {
+		if bytes.Equal(output.Bytes(), payout) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LookupService) SaveListing(ctx context.Context, outpoint *overlay.Outpoint, domain string, ol *ordlock.OrdLock, height uint32, idx uint64) error {
+	listing := &Listing{
+		Outpoint: outpoint.String(),
+		Domain:   domain,
+		Price:    ol.Price,
+		PayOut:   hex.EncodeToString(ol.PayOut),
+		Height:   height,
+		Idx:      idx,
+	}
+	if ol.Seller != nil {
+		listing.Seller = ol.Seller.AddressString
+	}
+	listingJson, err := json.Marshal(listing)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		if err := p.HSet(ctx, l.key(ListingsKey), listing.Outpoint, listingJson).Err(); err != nil {
+			return err
+		} else if err := p.ZAdd(ctx, l.key(ListingSortKey(ListingSortPrice)), redis.Z{
+			Score:  float64(listing.Price),
+			Member: listing.Outpoint,
+		}).Err(); err != nil {
+			return err
+		} else if err := p.ZAdd(ctx, l.key(ListingSortKey(ListingSortRecent)), redis.Z{
+			Score:  HeightScore(height, idx),
+			Member: listing.Outpoint,
+		}).Err(); err != nil {
+			return err
+		} else if err := p.ZAdd(ctx, l.key(ListingSortKey(ListingSortLength)), redis.Z{
+			Score:  float64(len(domain)),
+			Member: listing.Outpoint,
+		}).Err(); err != nil {
+			return err
+		}
+		return nil
+	})
+	return err
+}
+
+func (l *LookupService) FindListing(ctx context.Context, outpoint *overlay.Outpoint) (*Listing, error) {
+	if listingJson, err := l.db.HGet(ctx, l.key(ListingsKey), outpoint.String()).Bytes(); err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		listing := &Listing{}
+		if err := json.Unmarshal(listingJson, listing); err != nil {
+			return nil, err
+		}
+		return listing, nil
+	}
+}
+
+// DropListing takes a listing out of the sorted indexes. The listing record
+// itself is kept until the spending transaction is seen, so it can still be
+// classified as a sale or a delisting.
+func (l *LookupService) DropListing(ctx context.Context, outpoint *overlay.Outpoint) error {
+	op := outpoint.String()
+	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, sort := range []ListingSort{ListingSortPrice, ListingSortRecent, ListingSortLength} {
+			if err := p.ZRem(ctx, l.key(ListingSortKey(sort)), op).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// CloseListing removes a listing entirely and returns it, or nil if the
+// outpoint was not listed.
+func (l *LookupService) CloseListing(ctx context.Context, outpoint *overlay.Outpoint) (*Listing, error) {
+	if listing, err := l.FindListing(ctx, outpoint); err != nil || listing == nil {
+		return nil, err
+	} else if err := l.DropListing(ctx, outpoint); err != nil {
+		return nil, err
+	} else if err := l.db.HDel(ctx, l.key(ListingsKey), listing.Outpoint).Err(); err != nil {
+		return nil, err
+	} else {
+		return listing, nil
+	}
+}
+
+func (l *LookupService) FindListings(ctx context.Context, sort ListingSort, offset int, limit int, reverse bool) ([]*Listing, error) {
+	var rev bool
+	switch sort {
+	case ListingSortPrice, ListingSortLength:
+		rev = reverse
+	case ListingSortRecent:
+		rev = !reverse
+	default:
+		return nil, errors.New("invalid sort")
+	}
+	ops, err := l.db.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:   l.key(ListingSortKey(sort)),
+		Start: offset,
+		Stop:  offset + limit - 1,
+		Rev:   rev,
+	}).Result()
+	if err != nil {
+		return nil, err
+	} else if len(ops) == 0 {
+		return []*Listing{}, nil
+	}
+	items, err := l.db.HMGet(ctx, l.key(ListingsKey), ops...).Result()
+	if err != nil {
+		return nil, err
+	}
+	listings := make([]*Listing, 0, len(items))
+	for _, item := range items {
+		if listingJson, ok := item.(string); !ok {
+			continue
+		} else {
+			listing := &Listing{}
+			if err := json.Unmarshal([]byte(listingJson), listing); err != nil {
+				return nil, err
+			}
+			listings = append(listings, listing)
+		}
+	}
+	return listings, nil
+}
+
+// FloorPrice returns the lowest active listing price, or 0 when nothing is
+// listed.
+func (l *LookupService) FloorPrice(ctx context.Context) (uint64, error) {
+	if results, err := l.db.ZRangeWithScores(ctx, l.key(ListingSortKey(ListingSortPrice)), 0, 0).Result(); err != nil {
+		return 0, err
+	} else if len(results) == 0 {
+		return 0, nil
+	} else {
+		return uint64(results[0].Score), nil
+	}
+}
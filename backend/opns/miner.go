@@ -0,0 +1,177 @@
+package opns
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/util"
+)
+
+type Progress struct {
+	Hashes   uint64        `json:"hashes"`
+	Elapsed  time.Duration `json:"elapsed"`
+	Hashrate float64       `json:"hashrate"`
+	ETA      time.Duration `json:"eta"`
+}
+
+// Miner searches for a nonce that extends a name's proof of work by one
+// character. Each worker draws a starting nonce from Nonces and counts up
+// from it, so a miner with one worker and a fixed nonce source always finds
+// the same solution.
+type Miner struct {
+	Difficulty       int
+	Workers          int
+	Nonces           io.Reader
+	ProgressInterval time.Duration
+	OnProgress       func(Progress)
+	noncesMu         sync.Mutex
+	hashes           atomic.Uint64
+}
+
+func NewMiner(difficulty int, workers int) *Miner {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Miner{
+		Difficulty:       difficulty,
+		Workers:          workers,
+		Nonces:           rand.Reader,
+		ProgressInterval: time.Second,
+	}
+}
+
+// Hashes returns the number of hashes computed so far.
+func (m *Miner) Hashes() uint64 {
+	return m.hashes.Load()
+}
+
+// Progress reports the hashrate since start and the expected time to a
+// solution. Mining is memoryless, so the ETA does not shrink as hashes are
+// spent.
+func (m *Miner) Progress(start time.Time) Progress {
+	p := Progress{
+		Hashes:  m.Hashes(),
+		Elapsed: time.Since(start),
+	}
+	if p.Elapsed > 0 {
+		p.Hashrate = float64(p.Hashes) / p.Elapsed.Seconds()
+	}
+	if p.Hashrate > 0 {
+		// Saturate rather than overflow at high difficulty.
+		if eta := math.Exp2(float64(m.Difficulty)) / p.Hashrate * float64(time.Second); eta < math.MaxInt64 {
+			p.ETA = time.Duration(eta)
+		} else {
+			p.ETA = math.MaxInt64
+		}
+	}
+	return p
+}
+
+// MeetsDifficulty reports whether the top difficulty bits of hash, read as a
+// little-endian number, are all zero.
+func MeetsDifficulty(hash []byte, difficulty int) bool {
+	testInt := new(big.Int).SetBytes(util.ReverseBytes(hash))
+	testInt = testInt.Rsh(testInt, uint(256-difficulty))
+	return testInt.Cmp(comp) == 0
+}
+
+func (m *Miner) startNonce() ([]byte, error) {
+	m.noncesMu.Lock()
+	defer m.noncesMu.Unlock()
+	nonce := make([]byte, 32)
+	if _, err := io.ReadFull(m.Nonces, nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// Mine runs until a solution for pow extended by char is found or ctx is
+// done. All workers have exited by the time it returns.
+func (m *Miner) Mine(ctx context.Context, pow []byte, char byte) (*Pow, error) {
+	if m.Difficulty < 0 || m.Difficulty > 256 {
+		return nil, errors.New("difficulty must be between 0 and 256")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	m.hashes.Store(0)
+	start := time.Now()
+	found := make(chan *Pow, 1)
+	errs := make(chan error, m.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < m.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := m.startNonce()
+			if err != nil {
+				errs <- err
+				cancel()
+				return
+			}
+			test := make([]byte, 0, len(pow)+1+len(nonce))
+			test = append(test, pow...)
+			test = append(test, char)
+			prefix := len(test)
+			for ctx.Err() == nil {
+				test = append(test[:prefix], nonce...)
+				hash := sha256.Sum256(test)
+				hash = sha256.Sum256(hash[:])
+				m.hashes.Add(1)
+				if MeetsDifficulty(hash[:], m.Difficulty) {
+					select {
+					case found <- &Pow{
+						Nonce: append([]byte{}, nonce...),
+						Hash:  hash[:],
+					}:
+					default:
+					}
+					cancel()
+					return
+				}
+				binary.LittleEndian.PutUint64(nonce, binary.LittleEndian.Uint64(nonce)+1)
+			}
+		}()
+	}
+
+	if m.OnProgress != nil && m.ProgressInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(m.ProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					m.OnProgress(m.Progress(start))
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	select {
+	case solution := <-found:
+		solution.Hashes = m.Hashes()
+		return solution, nil
+	default:
+	}
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	return nil, ctx.Err()
+}
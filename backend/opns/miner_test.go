@@ -0,0 +1,154 @@
+package opns
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPow = bytes.Repeat([]byte{0xab}, 32)
+
+func TestMinerFixedNonce(t *testing.T) {
+	start := bytes.Repeat([]byte{0x01}, 32)
+	var solutions []*Pow
+	for i := 0; i < 2; i++ {
+		m := NewMiner(10, 1)
+		m.Nonces = bytes.NewReader(start)
+		solution, err := m.Mine(context.Background(), testPow, 'a')
+		if err != nil {
+			t.Fatal(err)
+		}
+		solutions = append(solutions, solution)
+	}
+
+	solution := solutions[0]
+	test := append(append(append([]byte{}, testPow...), 'a'), solution.Nonce...)
+	hash := sha256.Sum256(test)
+	hash = sha256.Sum256(hash[:])
+	if !bytes.Equal(hash[:], solution.Hash) {
+		t.Errorf("hash %x does not match nonce, want %x", solution.Hash, hash)
+	} else if !MeetsDifficulty(solution.Hash, 10) {
+		t.Errorf("hash %x does not meet difficulty", solution.Hash)
+	} else if !bytes.Equal(solution.Nonce[8:], start[8:]) {
+		t.Errorf("nonce %x did not count up from %x", solution.Nonce, start)
+	} else if solution.Hashes == 0 {
+		t.Error("no hashes counted")
+	}
+	if !bytes.Equal(solutions[1].Nonce, solution.Nonce) {
+		t.Errorf("second run found %x, want %x", solutions[1].Nonce, solution.Nonce)
+	}
+}
+
+func TestMinerZeroDifficulty(t *testing.T) {
+	m := NewMiner(0, 1)
+	m.Nonces = bytes.NewReader(make([]byte, 32))
+	if solution, err := m.Mine(context.Background(), testPow, 'a'); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(solution.Nonce, make([]byte, 32)) {
+		t.Errorf("nonce %x, want the starting nonce", solution.Nonce)
+	} else if solution.Hashes != 1 {
+		t.Errorf("%d hashes, want 1", solution.Hashes)
+	}
+}
+
+func TestMinerReuse(t *testing.T) {
+	start := bytes.Repeat([]byte{0x01}, 32)
+	m := NewMiner(10, 1)
+	var solutions []*Pow
+	for i := 0; i < 2; i++ {
+		m.Nonces = bytes.NewReader(start)
+		solution, err := m.Mine(context.Background(), testPow, 'a')
+		if err != nil {
+			t.Fatal(err)
+		}
+		solutions = append(solutions, solution)
+	}
+	// Each run counts only its own hashes.
+	if solutions[1].Hashes != solutions[0].Hashes {
+		t.Errorf("second run counted %d hashes, want %d", solutions[1].Hashes, solutions[0].Hashes)
+	} else if m.Hashes() != solutions[1].Hashes {
+		t.Errorf("miner reports %d hashes, want %d", m.Hashes(), solutions[1].Hashes)
+	}
+}
+
+func TestMinerProgress(t *testing.T) {
+	m := NewMiner(256, 2)
+	m.ProgressInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var reports []Progress
+	m.OnProgress = func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if reports = append(reports, p); len(reports) == 3 {
+			cancel()
+		}
+	}
+
+	if _, err := m.Mine(ctx, testPow, 'a'); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 3 {
+		t.Fatalf("got %d progress reports, want 3", len(reports))
+	}
+	for i, p := range reports {
+		if p.Hashes == 0 || p.Hashrate <= 0 || p.ETA <= 0 {
+			t.Errorf("report %d is empty: %+v", i, p)
+		} else if i > 0 && p.Hashes < reports[i-1].Hashes {
+			t.Errorf("report %d went back from %d to %d hashes", i, reports[i-1].Hashes, p.Hashes)
+		}
+	}
+}
+
+func TestMinerCancel(t *testing.T) {
+	m := NewMiner(256, 4)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if solution, err := m.Mine(ctx, testPow, 'a'); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, %v, want context.DeadlineExceeded", solution, err)
+	} else if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("took %v to stop", elapsed)
+	}
+}
+
+func TestMinerNonceError(t *testing.T) {
+	m := NewMiner(256, 2)
+	m.Nonces = bytes.NewReader(make([]byte, 40))
+	if _, err := m.Mine(context.Background(), testPow, 'a'); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestMinerInvalidDifficulty(t *testing.T) {
+	for _, difficulty := range []int{-1, 257} {
+		if _, err := NewMiner(difficulty, 1).Mine(context.Background(), testPow, 'a'); err == nil {
+			t.Errorf("difficulty %d was accepted", difficulty)
+		}
+	}
+}
+
+func BenchmarkMiner(b *testing.B) {
+	m := NewMiner(256, 1)
+	m.ProgressInterval = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.ResetTimer()
+	go func() {
+		for m.Hashes() < uint64(b.N) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	m.Mine(ctx, testPow, 'a')
+	b.StopTimer()
+	b.ReportMetric(float64(m.Hashes())/b.Elapsed().Seconds(), "hashes/s")
+}
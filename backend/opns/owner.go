@@ -0,0 +1,98 @@
+package opns
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+)
+
+type OwnerType string
+
+var (
+	OwnerTypeP2PKH    OwnerType = "p2pkh"
+	OwnerTypeP2PK     OwnerType = "p2pk"
+	OwnerTypeMultisig OwnerType = "multisig"
+	OwnerTypeCustom   OwnerType = "custom"
+)
+
+// Owner identifies whoever can spend a name. Address is only set for scripts
+// spendable by a single key; ScriptHash is the hex sha256 of the lock and is
+// always set.
+type Owner struct {
+	Type       OwnerType `json:"type"`
+	Address    string    `json:"address,omitempty"`
+	ScriptHash string    `json:"scriptHash"`
+}
+
+// ID is the address when there is one, otherwise the script hash.
+func (o *Owner) ID() string {
+	if o.Address != "" {
+		return o.Address
+	}
+	return o.ScriptHash
+}
+
+// Events indexes the owner by script hash and lock type, and by address
+// under the p2pkh event when the owner has one, so a wallet finds P2PK names
+// alongside its P2PKH names.
+func (o *Owner) Events() []string {
+	events := []string{
+		"owner:" + o.ScriptHash,
+		"lock:" + string(o.Type),
+	}
+	if o.Address != "" {
+		events = append(events, "p2pkh:"+o.Address)
+	}
+	return events
+}
+
+func ScriptHash(s *script.Script) string {
+	hash := sha256.Sum256(*s)
+	return hex.EncodeToString(hash[:])
+}
+
+// lockingPart drops any OP_RETURN data, such as MAP records, appended to a
+// lock so that it does not change the owner's script hash.
+func lockingPart(s *script.Script) *script.Script {
+	pos := 0
+	for pos < len(*s) {
+		start := pos
+		if op, err := s.ReadOp(&pos); err != nil {
+			break
+		} else if op.Op == script.OpRETURN {
+			return script.NewFromBytes((*s)[:start])
+		}
+	}
+	return s
+}
+
+// DecodeOwner classifies the lock s. It returns nil for an empty script.
+func DecodeOwner(s *script.Script) *Owner {
+	if s == nil {
+		return nil
+	}
+	s = lockingPart(s)
+	if len(*s) == 0 {
+		return nil
+	}
+	owner := &Owner{
+		Type:       OwnerTypeCustom,
+		ScriptHash: ScriptHash(s),
+	}
+	if p := p2pkh.Decode(s, true); p != nil {
+		owner.Type = OwnerTypeP2PKH
+		owner.Address = p.AddressString
+	} else if s.IsP2PK() {
+		owner.Type = OwnerTypeP2PK
+		if pubKey, err := s.PubKey(); err == nil {
+			if add, err := script.NewAddressFromPublicKey(pubKey, true); err == nil {
+				owner.Address = add.AddressString
+			}
+		}
+	} else if s.IsMultiSigOut() {
+		owner.Type = OwnerTypeMultisig
+	}
+	return owner
+}
@@ -0,0 +1,72 @@
+package opns
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+func TestDecodeOwner(t *testing.T) {
+	const (
+		pubKey  = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+		pubKey2 = "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+		address = "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"
+		p2pkh   = "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac"
+		p2pk    = "21" + pubKey + "ac"
+		multi   = "5121" + pubKey + "21" + pubKey2 + "52ae"
+		custom  = "5187"
+		data    = "6a0474657374"
+	)
+	tests := []struct {
+		name    string
+		lock    string
+		owner   string // the lock the owner is hashed from
+		typ     OwnerType
+		address string
+	}{
+		{"p2pkh", p2pkh, p2pkh, OwnerTypeP2PKH, address},
+		{"p2pk", p2pk, p2pk, OwnerTypeP2PK, address},
+		{"multisig", multi, multi, OwnerTypeMultisig, ""},
+		{"custom", custom, custom, OwnerTypeCustom, ""},
+		{"p2pkh with data", p2pkh + data, p2pkh, OwnerTypeP2PKH, address},
+		{"p2pk with data", p2pk + data, p2pk, OwnerTypeP2PK, address},
+		{"multisig with data", multi + data, multi, OwnerTypeMultisig, ""},
+		{"custom with data", custom + data, custom, OwnerTypeCustom, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock, _ := script.NewFromHex(tt.lock)
+			ownerLock, _ := script.NewFromHex(tt.owner)
+			hash := ScriptHash(ownerLock)
+			owner := DecodeOwner(lock)
+			if owner == nil {
+				t.Fatal("no owner")
+			} else if owner.Type != tt.typ || owner.Address != tt.address || owner.ScriptHash != hash {
+				t.Fatalf("got %+v, want %s %q %s", owner, tt.typ, tt.address, hash)
+			}
+
+			want, id := []string{"owner:" + hash, "lock:" + string(tt.typ)}, hash
+			if tt.address != "" {
+				want, id = append(want, "p2pkh:"+tt.address), tt.address
+			}
+			if events := owner.Events(); !slices.Equal(events, want) {
+				t.Errorf("events %v, want %v", events, want)
+			} else if owner.ID() != id {
+				t.Errorf("ID %s, want %s", owner.ID(), id)
+			}
+		})
+	}
+}
+
+func TestDecodeOwnerEmpty(t *testing.T) {
+	for _, lock := range []string{"", "6a0474657374"} {
+		s, _ := script.NewFromHex(lock)
+		if owner := DecodeOwner(s); owner != nil {
+			t.Errorf("%q: got %+v, want no owner", lock, owner)
+		}
+	}
+	if owner := DecodeOwner(nil); owner != nil {
+		t.Errorf("nil script: got %+v", owner)
+	}
+}
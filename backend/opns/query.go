@@ -0,0 +1,637 @@
+package opns
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/redis/go-redis/v9"
+)
+
+// MintKey scores each domain by the height it was minted at, 0 while the mint
+// is unconfirmed. OriginKey maps each domain to its mint outpoint.
+var MintKey = "nm:mint"
+var OriginKey = "nm:origin"
+
+// NameIndexKey scores each unspent name output for sorting and range
+// filters: by position for recent, by domain length, and by mint height.
+func NameIndexKey(sort NameSort) string {
+	return "nm:by:" + string(sort)
+}
+
+// NameDomainKey holds the domain of an unspent name output, so names can be
+// sorted alphabetically by Redis.
+func NameDomainKey(op string) string {
+	return "nm:dom:" + op
+}
+
+// queryKeyTTL bounds how long the scratch keys of a query outlive it.
+const queryKeyTTL = time.Minute
+
+type NameSort string
+
+var (
+	NameSortRecent NameSort = "recent"
+	NameSortName   NameSort = "name"
+	NameSortLength NameSort = "length"
+	NameSortPrice  NameSort = "price"
+	NameSortMint   NameSort = "mint"
+)
+
+const MaxQueryLimit = 1000
+
+type Range struct {
+	Min *uint64 `json:"min,omitempty"`
+	Max *uint64 `json:"max,omitempty"`
+}
+
+func (r *Range) Contains(v uint64) bool {
+	return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v <= *r.Max)
+}
+
+// NameQuery selects unspent name outputs by typed filters. Every filter that
+// is set must match.
+type NameQuery struct {
+	Owner   string            `json:"owner,omitempty"`
+	Listed  *bool             `json:"listed,omitempty"`
+	Price   *Range            `json:"price,omitempty"`
+	Length  *Range            `json:"length,omitempty"`
+	Mint    *Range            `json:"mint,omitempty"`
+	Records map[string]string `json:"records,omitempty"`
+	Sort    NameSort          `json:"sort,omitempty"`
+	Reverse bool              `json:"rev,omitempty"`
+	Offset  int               `json:"offset,omitempty"`
+	Limit   int               `json:"limit,omitempty"`
+}
+
+type Name struct {
+	Outpoint  string            `json:"outpoint"`
+	Domain    string            `json:"domain"`
+	Owner     string            `json:"owner,omitempty"`
+	OwnerType OwnerType         `json:"ownerType,omitempty"`
+	OwnerHash string            `json:"ownerHash,omitempty"`
+	Listing   *Listing          `json:"listing,omitempty"`
+	Records   map[string]string `json:"records,omitempty"`
+	Mint      uint32            `json:"mint"`
+}
+
+type QueryError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// QueryErrors is returned for questions that are malformed, so callers can
+// tell them apart from storage failures.
+type QueryErrors []*QueryError
+
+func (e QueryErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", err.Field, err.Message))
+	}
+	return "invalid query: " + strings.Join(msgs, "; ")
+}
+
+func validateRange(field string, r *Range) *QueryError {
+	if r != nil && r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return &QueryError{Field: field, Message: "min is greater than max"}
+	}
+	return nil
+}
+
+func (q *NameQuery) Validate() error {
+	var errs QueryErrors
+	if q.Owner != "" && !isScriptHash(q.Owner) {
+		if _, err := script.NewAddressFromString(q.Owner); err != nil {
+			errs = append(errs, &QueryError{Field: "owner", Message: "must be an address or script hash"})
+		}
+	}
+	for field, r := range map[string]*Range{"price": q.Price, "length": q.Length, "mint": q.Mint} {
+		if err := validateRange(field, r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if q.Price != nil && q.Listed != nil && !*q.Listed {
+		errs = append(errs, &QueryError{Field: "price", Message: "unlisted names have no price"})
+	}
+	for key := range q.Records {
+		if key == "" {
+			errs = append(errs, &QueryError{Field: "records", Message: "record keys must not be empty"})
+		}
+	}
+	switch q.Sort {
+	case "", NameSortRecent, NameSortName, NameSortLength, NameSortPrice, NameSortMint:
+	default:
+		errs = append(errs, &QueryError{Field: "sort", Message: fmt.Sprintf("unknown sort %q", q.Sort)})
+	}
+	if q.Offset < 0 {
+		errs = append(errs, &QueryError{Field: "offset", Message: "must not be negative"})
+	}
+	if q.Limit < 0 || q.Limit > MaxQueryLimit {
+		errs = append(errs, &QueryError{Field: "limit", Message: fmt.Sprintf("must be between 0 and %d", MaxQueryLimit)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (q *Question) Validate() error {
+	var errs QueryErrors
+	if q.Names != nil {
+		if q.Event != "" || len(q.Events) > 0 {
+			errs = append(errs, &QueryError{Field: "names", Message: "cannot be combined with event or events"})
+		} else if err := q.Names.Validate(); err != nil {
+			return err
+		}
+	} else if q.Event == "" && len(q.Events) == 0 {
+		errs = append(errs, &QueryError{Field: "event", Message: "one of event, events or names is required"})
+	}
+	for _, event := range q.Events {
+		if event == "" {
+			errs = append(errs, &QueryError{Field: "events", Message: "events must not be empty"})
+			break
+		}
+	}
+	if q.JoinType != nil && (*q.JoinType < JoinTypeIntersect || *q.JoinType > JoinTypeDifference) {
+		errs = append(errs, &QueryError{Field: "join", Message: "invalid join type"})
+	}
+	if q.Limit < 0 {
+		errs = append(errs, &QueryError{Field: "limit", Message: "must not be negative"})
+	}
+	switch q.Format {
+	case "", AnswerFormatBeef, AnswerFormatJson:
+	default:
+		errs = append(errs, &QueryError{Field: "format", Message: fmt.Sprintf("unknown format %q", q.Format)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (l *LookupService) saveMint(ctx context.Context, domain string, outpoint *overlay.Outpoint, height uint32, idx uint64) error {
+	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		if err := p.ZAdd(ctx, l.key(MintKey), redis.Z{
+			Score:  float64(height),
+			Member: domain,
+		}).Err(); err != nil {
+			return err
+		}
+		return p.HSet(ctx, l.key(OriginKey), domain, outpoint.String()).Err()
+	})
+	return err
+}
+
+// updateMint moves a domain's mint height when its origin output confirms.
+func (l *LookupService) updateMint(ctx context.Context, outpoint *overlay.Outpoint, height uint32) error {
+	events, err := l.FindEvents(ctx, outpoint)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if !strings.HasPrefix(event, "opns:") {
+			continue
+		}
+		domain := strings.TrimPrefix(event, "opns:")
+		if origin, err := l.db.HGet(ctx, l.key(OriginKey), domain).Result(); err == redis.Nil {
+			return nil
+		} else if err != nil {
+			return err
+		} else if origin != outpoint.String() {
+			continue
+		} else if ops, err := l.db.ZRange(ctx, l.key(EventKey(event)), 0, -1).Result(); err != nil {
+			return err
+		} else {
+			_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+				p.ZAdd(ctx, l.key(MintKey), redis.Z{
+					Score:  float64(height),
+					Member: domain,
+				})
+				for _, op := range ops {
+					p.ZAddXX(ctx, l.key(NameIndexKey(NameSortMint)), redis.Z{
+						Score:  float64(height),
+						Member: op,
+					})
+				}
+				return nil
+			})
+			return err
+		}
+	}
+	return nil
+}
+
+// indexName adds an unspent name output to the name indexes.
+func (l *LookupService) indexName(ctx context.Context, op string, domain string, score float64) error {
+	mint, err := l.db.ZScore(ctx, l.key(MintKey), domain).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	_, err = l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, l.key(NameIndexKey(NameSortRecent)), redis.Z{Score: score, Member: op})
+		p.ZAdd(ctx, l.key(NameIndexKey(NameSortLength)), redis.Z{Score: float64(len(domain)), Member: op})
+		p.ZAdd(ctx, l.key(NameIndexKey(NameSortMint)), redis.Z{Score: mint, Member: op})
+		p.Set(ctx, l.key(NameDomainKey(op)), domain, 0)
+		return nil
+	})
+	return err
+}
+
+// unindexName takes spent or deleted outputs out of the name indexes.
+func (l *LookupService) unindexName(ctx context.Context, ops ...string) error {
+	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for _, sort := range []NameSort{NameSortRecent, NameSortLength, NameSortMint} {
+			members := make([]interface{}, len(ops))
+			for i, op := range ops {
+				members[i] = op
+			}
+			p.ZRem(ctx, l.key(NameIndexKey(sort)), members...)
+		}
+		for _, op := range ops {
+			p.Del(ctx, l.key(NameDomainKey(op)))
+		}
+		return nil
+	})
+	return err
+}
+
+// restoreName puts an output that is unspent again back in the name
+// indexes, if it carries a name.
+func (l *LookupService) restoreName(ctx context.Context, outpoint *overlay.Outpoint) error {
+	op := outpoint.String()
+	if events, err := l.FindEvents(ctx, outpoint); err != nil {
+		return err
+	} else if name := nameFromEvents(op, events); name.Domain == "" {
+		return nil
+	} else if score, err := l.db.ZScore(ctx, l.key(EventKey("opns")), op).Result(); err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return err
+	} else {
+		return l.indexName(ctx, op, name.Domain, score)
+	}
+}
+
+// RebuildNameIndex fills the name indexes from the events of unspent names.
+// It runs once, for indexes written before the name indexes were kept.
+func (l *LookupService) RebuildNameIndex(ctx context.Context) error {
+	if kept, err := l.db.Exists(ctx, l.key(NameIndexKey(NameSortRecent))).Result(); err != nil || kept > 0 {
+		return err
+	}
+	count := 0
+	for start := int64(0); ; start += 1000 {
+		candidates, err := l.db.ZRangeWithScores(ctx, l.key(EventKey("opns")), start, start+999).Result()
+		if err != nil {
+			return err
+		} else if len(candidates) == 0 {
+			break
+		}
+		ops := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			ops[i] = candidate.Member.(string)
+		}
+		names, err := l.loadNames(ctx, ops)
+		if err != nil {
+			return err
+		}
+		for i, name := range names {
+			if name == nil {
+				continue
+			} else if err := l.indexName(ctx, name.Outpoint, name.Domain, candidates[i].Score); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("Rebuilt name indexes from %d names", count)
+	}
+	return nil
+}
+
+// QueryNames answers a name query in Redis: the filters are intersected into
+// a scratch set scored by the sort, and only the requested page is loaded.
+// Names that sort equal are ordered by outpoint.
+func (l *LookupService) QueryNames(ctx context.Context, q *NameQuery) ([]*Name, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	limit := int64(q.Limit)
+	if limit == 0 {
+		limit = 100
+	}
+
+	var scratch []string
+	defer func() {
+		if len(scratch) > 0 {
+			l.db.Del(context.WithoutCancel(ctx), scratch...)
+		}
+	}()
+	newKey := func() string {
+		key := l.key(fmt.Sprintf("tmp:q:%016x", rand.Uint64()))
+		scratch = append(scratch, key)
+		return key
+	}
+
+	sortIndex := NameSortRecent
+	if q.Sort == NameSortLength || q.Sort == NameSortMint {
+		sortIndex = q.Sort
+	}
+	keys := []string{l.key(NameIndexKey(sortIndex))}
+	if isScriptHash(q.Owner) {
+		keys = append(keys, l.key(EventKey("owner:"+q.Owner)))
+	} else if q.Owner != "" {
+		keys = append(keys, l.key(EventKey("p2pkh:"+q.Owner)))
+	}
+	for key, value := range q.Records {
+		keys = append(keys, l.key(EventKey(RecordEvent(key, value))))
+	}
+	if q.Listed != nil && *q.Listed {
+		keys = append(keys, l.key(ListingSortKey(ListingSortPrice)))
+	}
+	mint := q.Mint
+	if mint != nil && (mint.Min == nil || *mint.Min == 0) {
+		// Unconfirmed mints are scored 0 and never match a mint range.
+		one := uint64(1)
+		mint = &Range{Min: &one, Max: mint.Max}
+	}
+	for _, r := range []struct {
+		key   string
+		match *Range
+	}{
+		{ListingSortKey(ListingSortPrice), q.Price},
+		{NameIndexKey(NameSortLength), q.Length},
+		{NameIndexKey(NameSortMint), mint},
+	} {
+		if r.match == nil {
+			continue
+		}
+		dest := newKey()
+		if err := l.db.ZRangeStore(ctx, dest, redis.ZRangeArgs{
+			Key:     l.key(r.key),
+			Start:   r.match.min(),
+			Stop:    r.match.max(),
+			ByScore: true,
+		}).Err(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, dest)
+	}
+
+	candidates := keys[0]
+	if len(keys) > 1 || q.Listed != nil && !*q.Listed {
+		candidates = newKey()
+		weights := make([]float64, len(keys))
+		weights[0] = 1
+		if err := l.db.ZInterStore(ctx, candidates, &redis.ZStore{Keys: keys, Weights: weights}).Err(); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range scratch {
+		l.db.Expire(ctx, key, queryKeyTTL)
+	}
+	if q.Listed != nil && !*q.Listed {
+		if err := l.db.ZDiffStore(ctx, candidates, candidates, l.key(ListingSortKey(ListingSortPrice))).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var ops []string
+	var err error
+	switch q.Sort {
+	case NameSortName:
+		ops, err = l.sortByDomain(ctx, candidates, int64(q.Offset), limit, q.Reverse)
+	case NameSortPrice:
+		ops, err = l.sortByPrice(ctx, candidates, newKey, int64(q.Offset), limit, q.Reverse)
+	default:
+		ops, err = l.db.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:   candidates,
+			Start: q.Offset,
+			Stop:  int64(q.Offset) + limit - 1,
+			Rev:   (q.Sort == "" || q.Sort == NameSortRecent) != q.Reverse,
+		}).Result()
+	}
+	if err != nil {
+		return nil, err
+	} else if len(ops) == 0 {
+		return []*Name{}, nil
+	}
+
+	names, err := l.loadNames(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	page := make([]*Name, 0, len(names))
+	for _, name := range names {
+		if name != nil {
+			page = append(page, name)
+		}
+	}
+	return page, nil
+}
+
+// sortByDomain pages through candidates in domain order.
+func (l *LookupService) sortByDomain(ctx context.Context, candidates string, offset int64, count int64, reverse bool) ([]string, error) {
+	order := "ASC"
+	if reverse {
+		order = "DESC"
+	}
+	return l.db.Sort(ctx, candidates, &redis.Sort{
+		By:     l.key(NameDomainKey("*")),
+		Offset: offset,
+		Count:  count,
+		Order:  order,
+		Alpha:  true,
+	}).Result()
+}
+
+// sortByPrice pages through candidates with listed names in price order
+// ahead of unlisted names in domain order, or the reverse.
+func (l *LookupService) sortByPrice(ctx context.Context, candidates string, newKey func() string, offset int64, count int64, reverse bool) ([]string, error) {
+	listed, unlisted := newKey(), newKey()
+	priceKey := l.key(ListingSortKey(ListingSortPrice))
+	if err := l.db.ZInterStore(ctx, listed, &redis.ZStore{
+		Keys:    []string{candidates, priceKey},
+		Weights: []float64{0, 1},
+	}).Err(); err != nil {
+		return nil, err
+	} else if err := l.db.ZDiffStore(ctx, unlisted, candidates, priceKey).Err(); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{listed, unlisted} {
+		l.db.Expire(ctx, key, queryKeyTTL)
+	}
+	byPrice := func(offset, count int64) ([]string, error) {
+		return l.db.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:   listed,
+			Start: offset,
+			Stop:  offset + count - 1,
+			Rev:   reverse,
+		}).Result()
+	}
+	byDomain := func(offset, count int64) ([]string, error) {
+		return l.sortByDomain(ctx, unlisted, offset, count, reverse)
+	}
+
+	first, second := byPrice, byDomain
+	firstKey := listed
+	if reverse {
+		first, second = byDomain, byPrice
+		firstKey = unlisted
+	}
+	firstCount, err := l.db.ZCard(ctx, firstKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var ops []string
+	if offset < firstCount {
+		if ops, err = first(offset, count); err != nil {
+			return nil, err
+		}
+	}
+	if rest := count - int64(len(ops)); rest > 0 {
+		more, err := second(max(offset-firstCount, 0), rest)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, more...)
+	}
+	return ops, nil
+}
+
+func (r *Range) min() string {
+	if r.Min == nil {
+		return "-inf"
+	}
+	return strconv.FormatUint(*r.Min, 10)
+}
+
+func (r *Range) max() string {
+	if r.Max == nil {
+		return "+inf"
+	}
+	return strconv.FormatUint(*r.Max, 10)
+}
+
+// loadNames decodes the current state of each outpoint from its events in a
+// single pipelined pass. Entries are nil for spent outputs and outputs that
+// do not carry a name.
+func (l *LookupService) loadNames(ctx context.Context, ops []string) ([]*Name, error) {
+	outpoints := make([]*overlay.Outpoint, len(ops))
+	for i, op := range ops {
+		var err error
+		if outpoints[i], err = overlay.NewOutpointFromString(op); err != nil {
+			return nil, err
+		}
+	}
+	eventCmds := make([]*redis.StringSliceCmd, len(ops))
+	spentCmds := make([]*redis.FloatCmd, len(ops))
+	listingCmds := make([]*redis.StringCmd, len(ops))
+	if _, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, op := range ops {
+			eventCmds[i] = p.SMembers(ctx, l.key(OutpointEventsKey(outpoints[i])))
+			spentCmds[i] = p.ZScore(ctx, l.key(SpentKey), op)
+			listingCmds[i] = p.HGet(ctx, l.key(ListingsKey), op)
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	names := make([]*Name, len(ops))
+	for i, op := range ops {
+		if err := spentCmds[i].Err(); err == nil {
+			continue
+		} else if err != redis.Nil {
+			return nil, err
+		}
+		events, err := eventCmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		name := nameFromEvents(op, events)
+		if name.Domain == "" {
+			continue
+		}
+		if name.Listing, err = parseListing(listingCmds[i]); err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+
+	mintCmds := make(map[int]*redis.FloatCmd)
+	if _, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, name := range names {
+			if name != nil {
+				mintCmds[i] = p.ZScore(ctx, l.key(MintKey), name.Domain)
+			}
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, cmd := range mintCmds {
+		if mint, err := cmd.Result(); err == nil {
+			names[i].Mint = uint32(mint)
+		} else if err != redis.Nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// nameFromEvents rebuilds the decoded fields of an output from its events.
+func nameFromEvents(op string, events []string) *Name {
+	name := &Name{Outpoint: op}
+	for _, event := range events {
+		if strings.HasPrefix(event, "opns:") {
+			name.Domain = strings.TrimPrefix(event, "opns:")
+		} else if strings.HasPrefix(event, "p2pkh:") {
+			name.Owner = strings.TrimPrefix(event, "p2pkh:")
+		} else if strings.HasPrefix(event, "owner:") {
+			name.OwnerHash = strings.TrimPrefix(event, "owner:")
+		} else if strings.HasPrefix(event, "lock:") {
+			name.OwnerType = OwnerType(strings.TrimPrefix(event, "lock:"))
+		} else if key, value, ok := ParseRecordEvent(event); ok {
+			if name.Records == nil {
+				name.Records = make(map[string]string)
+			}
+			name.Records[key] = value
+		}
+	}
+	if name.Owner == "" {
+		name.Owner = name.OwnerHash
+	}
+	return name
+}
+
+func isScriptHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func parseListing(cmd *redis.StringCmd) (*Listing, error) {
+	if listingJson, err := cmd.Bytes(); err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		listing := &Listing{}
+		if err := json.Unmarshal(listingJson, listing); err != nil {
+			return nil, err
+		}
+		return listing, nil
+	}
+}
@@ -0,0 +1,52 @@
+package opns
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+// MapPrefix is the bitcom MAP protocol prefix used to attach records to a
+// name output.
+var MapPrefix = []byte("1PuQa7K62MiKCtssSLKy1kh56WWU7MtUR5")
+
+// RecordEvent is the event a record is indexed under.
+func RecordEvent(key string, value string) string {
+	return fmt.Sprintf("rec:%s=%s", key, value)
+}
+
+// ParseRecordEvent splits a record event back into its key and value.
+func ParseRecordEvent(event string) (key string, value string, ok bool) {
+	if !strings.HasPrefix(event, "rec:") {
+		return "", "", false
+	}
+	return strings.Cut(strings.TrimPrefix(event, "rec:"), "=")
+}
+
+// DecodeRecords reads MAP SET key/value pairs carried by an output script.
+func DecodeRecords(s *script.Script) map[string]string {
+	chunks, err := s.Chunks()
+	if err != nil {
+		return nil
+	}
+	var records map[string]string
+	for i := 0; i < len(chunks); i++ {
+		if !bytes.Equal(chunks[i].Data, MapPrefix) {
+			continue
+		} else if i+1 >= len(chunks) || string(chunks[i+1].Data) != "SET" {
+			continue
+		}
+		if records == nil {
+			records = make(map[string]string)
+		}
+		for i += 2; i+1 < len(chunks); i += 2 {
+			if string(chunks[i].Data) == "|" {
+				break
+			}
+			records[string(chunks[i].Data)] = string(chunks[i+1].Data)
+		}
+	}
+	return records
+}
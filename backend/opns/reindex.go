@@ -0,0 +1,202 @@
+package opns
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/redis/go-redis/v9"
+)
+
+// ShadowNamespace is where a reindex builds the new index before switching.
+var ShadowNamespace = "rx:"
+
+// indexPatterns matches every key owned by the lookup service.
+var indexPatterns = []string{"ev:*", "oe:*", "mkt:*", "nm:*", "blk:*", BlocksKey}
+
+type EventDiff struct {
+	Outpoint string   `json:"outpoint"`
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+type ReindexReport struct {
+	Outputs int          `json:"outputs"`
+	Diffs   []*EventDiff `json:"diffs"`
+}
+
+// Shadow returns a lookup service writing to the shadow namespace.
+func (l *LookupService) Shadow() *LookupService {
+	shadow := *l
+	shadow.ns = ShadowNamespace + l.ns
+	shadow.shadow = true
+	return &shadow
+}
+
+// Reindex replays every stored output of the topic through OutputAdded into
+// the shadow namespace, in block order with parents ahead of children, and
+// reports how the rebuilt events differ from the live index. Nothing in the
+// live index changes until Switch is called.
+func (l *LookupService) Reindex(ctx context.Context) (*ReindexReport, error) {
+	shadow := l.Shadow()
+	if err := shadow.clear(ctx); err != nil {
+		return nil, err
+	}
+	outputs, err := l.storage.FindUTXOsForTopic(ctx, l.topic, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(outputs, func(a, b *engine.Output) int {
+		if a.BlockHeight == 0 && b.BlockHeight != 0 {
+			return 1
+		} else if a.BlockHeight != 0 && b.BlockHeight == 0 {
+			return -1
+		} else if a.BlockHeight != b.BlockHeight {
+			return int(a.BlockHeight) - int(b.BlockHeight)
+		} else if a.BlockIdx < b.BlockIdx {
+			return -1
+		} else if a.BlockIdx > b.BlockIdx {
+			return 1
+		}
+		return 0
+	})
+
+	known := make(map[string]struct{}, len(outputs))
+	for _, output := range outputs {
+		known[output.Outpoint.String()] = struct{}{}
+	}
+	done := make(map[string]struct{}, len(outputs))
+	waiting := make(map[string][]*engine.Output)
+	var apply func(output *engine.Output) error
+	apply = func(output *engine.Output) error {
+		for _, consumed := range output.OutputsConsumed {
+			op := consumed.String()
+			if _, ok := known[op]; !ok {
+				continue
+			} else if _, ok := done[op]; !ok {
+				waiting[op] = append(waiting[op], output)
+				return nil
+			}
+		}
+		if err := shadow.OutputAdded(ctx, &output.Outpoint, output.Script, output.Topic, output.BlockHeight, output.BlockIdx); err != nil {
+			return err
+		}
+		if output.Spent {
+			if err := shadow.OutputSpent(ctx, &output.Outpoint, output.Topic); err != nil {
+				return err
+			}
+		}
+		op := output.Outpoint.String()
+		done[op] = struct{}{}
+		children := waiting[op]
+		delete(waiting, op)
+		for _, child := range children {
+			if err := apply(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, output := range outputs {
+		if err := apply(output); err != nil {
+			return nil, err
+		}
+		if (i+1)%10000 == 0 {
+			log.Printf("Reindexed %d of %d outputs", i+1, len(outputs))
+		}
+	}
+	if len(waiting) > 0 {
+		log.Printf("%d outputs are waiting on inputs that were never indexed", len(waiting))
+	}
+
+	report := &ReindexReport{Outputs: len(done)}
+	for _, output := range outputs {
+		op := &output.Outpoint
+		if oldEvents, err := l.FindEvents(ctx, op); err != nil {
+			return nil, err
+		} else if newEvents, err := shadow.FindEvents(ctx, op); err != nil {
+			return nil, err
+		} else if diff := diffEvents(oldEvents, newEvents); diff != nil {
+			diff.Outpoint = op.String()
+			report.Diffs = append(report.Diffs, diff)
+		}
+	}
+	return report, nil
+}
+
+func diffEvents(oldEvents, newEvents []string) *EventDiff {
+	diff := &EventDiff{}
+	for _, event := range newEvents {
+		if !slices.Contains(oldEvents, event) {
+			diff.Added = append(diff.Added, event)
+		}
+	}
+	for _, event := range oldEvents {
+		if !slices.Contains(newEvents, event) {
+			diff.Removed = append(diff.Removed, event)
+		}
+	}
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		return nil
+	}
+	return diff
+}
+
+// scanKeys lists the keys of the index. The reconfirm queue is left out, as
+// a reindex does not rebuild it and it must survive a switch.
+func (l *LookupService) scanKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	for _, pattern := range indexPatterns {
+		iter := l.db.Scan(ctx, 0, l.key(pattern), 1000).Iterator()
+		for iter.Next(ctx) {
+			if key := iter.Val(); key != l.key(ReconfirmKey) {
+				keys = append(keys, key)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (l *LookupService) clear(ctx context.Context) error {
+	if keys, err := l.scanKeys(ctx); err != nil {
+		return err
+	} else if len(keys) == 0 {
+		return nil
+	} else {
+		return l.db.Del(ctx, keys...).Err()
+	}
+}
+
+// Switch atomically replaces the live index with the shadow index built by
+// Reindex. Outputs indexed by the live service while the reindex ran are lost,
+// so ingest should be paused for the duration.
+func (l *LookupService) Switch(ctx context.Context) error {
+	shadow := l.Shadow()
+	liveKeys, err := l.scanKeys(ctx)
+	if err != nil {
+		return err
+	}
+	shadowKeys, err := shadow.scanKeys(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = l.db.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(liveKeys) > 0 {
+			if err := p.Del(ctx, liveKeys...).Err(); err != nil {
+				return err
+			}
+		}
+		for _, key := range shadowKeys {
+			if err := p.Rename(ctx, key, strings.TrimPrefix(key, ShadowNamespace)).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
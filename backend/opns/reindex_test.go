@@ -0,0 +1,70 @@
+package opns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLookup is a lookup service of root on an in-memory Redis.
+func newTestLookup(t *testing.T, root *Root) (*LookupService, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	l, err := NewLookupService("redis://"+mr.Addr(), nil, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, mr
+}
+
+func TestSwitchKeepsReconfirm(t *testing.T) {
+	namespaced, err := (&RootConfig{Topic: "tm_test"}).Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []*Root{DefaultRoot, namespaced} {
+		l, _ := newTestLookup(t, root)
+		ctx := context.Background()
+		shadow := l.Shadow()
+		for _, z := range []struct {
+			key    string
+			member string
+		}{
+			{l.key(EventKey("owner:live")), "a_0"},
+			{l.key(ReconfirmKey), "rolledback"},
+			{shadow.key(EventKey("owner:rebuilt")), "b_0"},
+		} {
+			if err := l.db.ZAdd(ctx, z.key, redis.Z{Score: 1, Member: z.member}).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.db.SAdd(ctx, l.key(BlockOutputsKey(100)), "a_0").Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := l.Switch(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range map[string]int64{
+			l.key(EventKey("owner:live")):         0,
+			l.key(BlockOutputsKey(100)):           0,
+			l.key(EventKey("owner:rebuilt")):      1,
+			shadow.key(EventKey("owner:rebuilt")): 0,
+			l.key(ReconfirmKey):                   1,
+		} {
+			if n, err := l.db.Exists(ctx, key).Result(); err != nil {
+				t.Fatal(err)
+			} else if n != want {
+				t.Errorf("%s: exists %d after switch, want %d", key, n, want)
+			}
+		}
+		if members, err := l.db.ZRange(ctx, l.key(ReconfirmKey), 0, -1).Result(); err != nil {
+			t.Fatal(err)
+		} else if len(members) != 1 || members[0] != "rolledback" {
+			t.Errorf("%s: reconfirm queue is %v after switch", root.Topic, members)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package opns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+// BlocksKey holds the hash of every block we have confirmed outputs in,
+// scored by height.
+var BlocksKey = "blocks"
+
+// UnhashedBlocksKey holds the heights of blocks with confirmed outputs whose
+// hash is yet to be recorded.
+var UnhashedBlocksKey = "blk:unhashed"
+
+// ReconfirmKey holds the txids rolled back by a reorg that still need their
+// place in the new chain settled, scored by when they were rolled back.
+var ReconfirmKey = "blk:reconfirm"
+
+// BlockOutputsKey holds the outpoints confirmed in the block at height.
+func BlockOutputsKey(height uint32) string {
+	return fmt.Sprintf("blk:%d", height)
+}
+
+// ChainSource supplies the transactions and merkle paths used to settle
+// outputs after a reorg.
+type ChainSource interface {
+	RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error)
+	Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error)
+}
+
+// SetChain sets the source rolled back transactions are settled against.
+// Without one they stay unconfirmed.
+func (l *LookupService) SetChain(chain ChainSource) {
+	l.chain = chain
+}
+
+// recordBlock remembers that outpoint was confirmed at height. The hash of
+// the block is looked up later by hashBlocks, so admission never waits on the
+// header source.
+func (l *LookupService) recordBlock(ctx context.Context, outpoint *overlay.Outpoint, height uint32) error {
+	if height == 0 || l.headers == nil {
+		return nil
+	}
+	_, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, l.key(BlockOutputsKey(height)), outpoint.String())
+		p.ZAdd(ctx, l.key(UnhashedBlocksKey), redis.Z{
+			Score:  float64(height),
+			Member: height,
+		})
+		return nil
+	})
+	return err
+}
+
+// hashBlocks records the hash of each block recorded without one.
+func (l *LookupService) hashBlocks(ctx context.Context) error {
+	heights, err := l.db.ZRange(ctx, l.key(UnhashedBlocksKey), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, heightStr := range heights {
+		height, err := strconv.ParseUint(heightStr, 10, 32)
+		if err != nil {
+			return err
+		}
+		if known, err := l.db.ZCount(ctx, l.key(BlocksKey), heightStr, heightStr).Result(); err != nil {
+			return err
+		} else if known == 0 {
+			if header, err := l.headers.BlockByHeight(ctx, uint32(height)); err != nil {
+				return err
+			} else if err := l.db.ZAdd(ctx, l.key(BlocksKey), redis.Z{
+				Score:  float64(height),
+				Member: header.Hash.String(),
+			}).Err(); err != nil {
+				return err
+			}
+		}
+		if err := l.db.ZRem(ctx, l.key(UnhashedBlocksKey), heightStr).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckReorg compares the most recent depth recorded blocks against the
+// header source and rolls back everything from the lowest orphaned block up.
+func (l *LookupService) CheckReorg(ctx context.Context, depth int64) error {
+	if l.headers == nil {
+		return nil
+	} else if err := l.hashBlocks(ctx); err != nil {
+		return err
+	}
+	blocks, err := l.db.ZRevRangeWithScores(ctx, l.key(BlocksKey), 0, depth-1).Result()
+	if err != nil {
+		return err
+	}
+	forkHeight := uint32(0)
+	for _, block := range blocks {
+		height := uint32(block.Score)
+		if header, err := l.headers.BlockByHeight(ctx, height); err != nil {
+			return err
+		} else if header.Hash.String() != block.Member.(string) {
+			forkHeight = height
+		}
+	}
+	if forkHeight == 0 {
+		return nil
+	}
+	return l.Rollback(ctx, forkHeight)
+}
+
+// Rollback returns every output confirmed at or above height to the mempool
+// state, in both storage and the event index, and queues its transaction for
+// Reconfirm to settle against the new chain.
+func (l *LookupService) Rollback(ctx context.Context, height uint32) error {
+	blocks, err := l.db.ZRangeByScoreWithScores(ctx, l.key(BlocksKey), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", height),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+	unhashed, err := l.db.ZRangeByScore(ctx, l.key(UnhashedBlocksKey), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", height),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+	heights := make([]uint32, 0, len(blocks)+len(unhashed))
+	for _, block := range blocks {
+		heights = append(heights, uint32(block.Score))
+	}
+	for _, heightStr := range unhashed {
+		if h, err := strconv.ParseUint(heightStr, 10, 32); err == nil {
+			heights = append(heights, uint32(h))
+		}
+	}
+	count := 0
+	now := float64(time.Now().Unix())
+	for _, blockHeight := range heights {
+		ops, err := l.db.SMembers(ctx, l.key(BlockOutputsKey(blockHeight))).Result()
+		if err != nil {
+			return err
+		}
+		for _, op := range ops {
+			if outpoint, err := overlay.NewOutpointFromString(op); err != nil {
+				return err
+			} else if output, err := l.storage.FindOutput(ctx, outpoint, &l.topic, nil, false); err != nil {
+				return err
+			} else if output == nil {
+				continue
+			} else if err := l.storage.UpdateOutputBlockHeight(ctx, outpoint, l.topic, 0, 0, output.AncillaryBeef); err != nil {
+				return err
+			} else if err := l.OutputBlockHeightUpdated(ctx, outpoint, 0, 0); err != nil {
+				return err
+			} else if err := l.db.ZAddNX(ctx, l.key(ReconfirmKey), redis.Z{
+				Score:  now,
+				Member: outpoint.Txid.String(),
+			}).Err(); err != nil {
+				return err
+			}
+			count++
+		}
+		if err := l.db.Del(ctx, l.key(BlockOutputsKey(blockHeight))).Err(); err != nil {
+			return err
+		}
+	}
+	log.Printf("Rolled back %d outputs from %d blocks at or above %d", count, len(heights), height)
+	_, err = l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRemRangeByScore(ctx, l.key(BlocksKey), fmt.Sprintf("%d", height), "+inf")
+		p.ZRemRangeByScore(ctx, l.key(UnhashedBlocksKey), fmt.Sprintf("%d", height), "+inf")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return l.Reconfirm(ctx)
+}
+
+// Reconfirm settles each rolled back transaction against the new chain. One
+// mined in the new chain is re-applied at its new height. One the chain
+// source no longer knows, orphaned with its block, is removed along with its
+// outputs, and the outputs it spent become unspent again. One still waiting
+// in the mempool stays queued.
+func (l *LookupService) Reconfirm(ctx context.Context) error {
+	if l.chain == nil {
+		return nil
+	}
+	txids, err := l.db.ZRange(ctx, l.key(ReconfirmKey), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for _, txidStr := range txids {
+		txid, err := chainhash.NewHashFromHex(txidStr)
+		if err != nil {
+			return err
+		}
+		settled := true
+		if proof, err := l.chain.Proof(ctx, txid); err != nil {
+			return err
+		} else if proof != nil {
+			settled, err = l.reapply(ctx, txid, proof)
+			if err != nil {
+				return err
+			}
+		} else if _, err := l.chain.RawTx(ctx, txid); errors.Is(err, ingest.ErrNotFound) {
+			if err := l.dropOrphan(ctx, txid); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			settled = false
+		}
+		if settled {
+			if err := l.db.ZRem(ctx, l.key(ReconfirmKey), txidStr).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// topicOutputs returns the outputs of txid held for the topic.
+func (l *LookupService) topicOutputs(ctx context.Context, txid *chainhash.Hash, includeBEEF bool) ([]*engine.Output, error) {
+	outputs, err := l.storage.FindOutputsForTransaction(ctx, txid, includeBEEF)
+	if err != nil {
+		return nil, err
+	}
+	held := outputs[:0]
+	for _, output := range outputs {
+		if output != nil && output.Topic == l.topic {
+			held = append(held, output)
+		}
+	}
+	return held, nil
+}
+
+// reapply confirms txid at the position proof gives it, once the proof is
+// checked against the new chain. It reports false if the header source has
+// yet to reach the proof's block.
+func (l *LookupService) reapply(ctx context.Context, txid *chainhash.Hash, proof *transaction.MerklePath) (bool, error) {
+	var idx uint64
+	found := false
+	for _, leaf := range proof.Path[0] {
+		if leaf.Hash != nil && leaf.Hash.Equal(*txid) {
+			idx, found = leaf.Offset, true
+			break
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("proof for %s does not include it", txid)
+	}
+	if root, err := proof.ComputeRoot(txid); err != nil {
+		return false, err
+	} else if header, err := l.headers.BlockByHeight(ctx, proof.BlockHeight); err != nil {
+		return false, nil
+	} else if !header.MerkleRoot.Equal(*root) {
+		return false, nil
+	}
+
+	outputs, err := l.topicOutputs(ctx, txid, true)
+	if err != nil || len(outputs) == 0 {
+		return true, err
+	}
+	if tx, err := transaction.NewTransactionFromBEEF(outputs[0].Beef); err != nil {
+		return false, err
+	} else {
+		tx.MerklePath = proof
+		if beef, err := tx.BEEF(); err != nil {
+			return false, err
+		} else if err := l.storage.UpdateTransactionBEEF(ctx, txid, beef); err != nil {
+			return false, err
+		}
+	}
+	for _, output := range outputs {
+		if err := l.storage.UpdateOutputBlockHeight(ctx, &output.Outpoint, l.topic, proof.BlockHeight, idx, output.AncillaryBeef); err != nil {
+			return false, err
+		} else if err := l.OutputBlockHeightUpdated(ctx, &output.Outpoint, proof.BlockHeight, idx); err != nil {
+			return false, err
+		}
+	}
+	log.Printf("Reconfirmed %s at %d:%d", txid, proof.BlockHeight, idx)
+	return true, nil
+}
+
+// unspender is storage that can mark an output unspent again.
+type unspender interface {
+	MarkUTXOAsUnspent(ctx context.Context, outpoint *overlay.Outpoint, topic string) error
+}
+
+// dropOrphan removes the outputs of txid and returns the outputs it spent to
+// unspent, so names resolve to their owner in the new chain.
+func (l *LookupService) dropOrphan(ctx context.Context, txid *chainhash.Hash) error {
+	outputs, err := l.topicOutputs(ctx, txid, false)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		for _, consumed := range output.OutputsConsumed {
+			if u, ok := l.storage.(unspender); ok {
+				if err := u.MarkUTXOAsUnspent(ctx, consumed, l.topic); err != nil {
+					return err
+				}
+			}
+			if err := l.db.ZRem(ctx, l.key(SpentKey), consumed.String()).Err(); err != nil {
+				return err
+			} else if err := l.restoreName(ctx, consumed); err != nil {
+				return err
+			}
+		}
+		if err := l.OutputDeleted(ctx, &output.Outpoint, l.topic); err != nil {
+			return err
+		} else if err := l.storage.DeleteOutput(ctx, &output.Outpoint, l.topic); err != nil {
+			return err
+		}
+	}
+	log.Printf("Dropped %d outputs of orphaned %s", len(outputs), txid)
+	return nil
+}
+
+// WatchReorgs runs CheckReorg on every tick until ctx is cancelled.
+func (l *LookupService) WatchReorgs(ctx context.Context, interval time.Duration, depth int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.CheckReorg(ctx, depth); err != nil {
+				log.Printf("Error checking for reorg: %v", err)
+			} else if err := l.Reconfirm(ctx); err != nil {
+				log.Printf("Error reconfirming rolled back transactions: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package opns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const MaxResolveNames = 5000
+
+type ResolveStatus string
+
+var (
+	ResolveStatusOwned        ResolveStatus = "owned"
+	ResolveStatusListed       ResolveStatus = "listed"
+	ResolveStatusSpent        ResolveStatus = "spent"
+	ResolveStatusUnregistered ResolveStatus = "unregistered"
+	ResolveStatusInvalid      ResolveStatus = "invalid"
+)
+
+type Resolution struct {
+	Query     string            `json:"query"`
+	Domain    string            `json:"domain,omitempty"`
+	Status    ResolveStatus     `json:"status"`
+	Outpoint  string            `json:"outpoint,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	OwnerType OwnerType         `json:"ownerType,omitempty"`
+	OwnerHash string            `json:"ownerHash,omitempty"`
+	Records   map[string]string `json:"records,omitempty"`
+	Listing   *Listing          `json:"listing,omitempty"`
+}
+
+// ParseHandle reduces a name or paymail handle to the domain it resolves.
+func ParseHandle(handle string) string {
+	handle = strings.TrimSpace(handle)
+	if alias, _, ok := strings.Cut(handle, "@"); ok {
+		handle = alias
+	}
+	return handle
+}
+
+// Resolve looks up the current output of every name in two pipelined passes,
+// one for the latest output of each name and one for its state. Results are
+// returned in the order of names.
+func (l *LookupService) Resolve(ctx context.Context, names []string) ([]*Resolution, error) {
+	results := make([]*Resolution, len(names))
+	latestCmds := make([]*redis.StringSliceCmd, len(names))
+	if _, err := l.db.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, handle := range names {
+			results[i] = &Resolution{
+				Query:  handle,
+				Domain: ParseHandle(handle),
+			}
+			if results[i].Domain == "" {
+				results[i].Status = ResolveStatusInvalid
+				continue
+			}
+			latestCmds[i] = p.ZRevRange(ctx, l.key(EventKey("opns:"+results[i].Domain)), 0, 0)
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	ops := make([]string, 0, len(names))
+	pending := make([]*Resolution, 0, len(names))
+	for i, cmd := range latestCmds {
+		if cmd == nil {
+			continue
+		} else if latest, err := cmd.Result(); err != nil {
+			return nil, err
+		} else if len(latest) == 0 {
+			results[i].Status = ResolveStatusUnregistered
+		} else {
+			results[i].Outpoint = latest[0]
+			ops = append(ops, latest[0])
+			pending = append(pending, results[i])
+		}
+	}
+	if len(ops) == 0 {
+		return results, nil
+	}
+
+	current, err := l.loadNames(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range current {
+		result := pending[i]
+		if name == nil {
+			result.Status = ResolveStatusSpent
+			continue
+		}
+		result.Owner = name.Owner
+		result.OwnerType = name.OwnerType
+		result.OwnerHash = name.OwnerHash
+		result.Records = name.Records
+		result.Listing = name.Listing
+		if name.Listing != nil {
+			result.Status = ResolveStatusListed
+		} else {
+			result.Status = ResolveStatusOwned
+		}
+	}
+	return results, nil
+}
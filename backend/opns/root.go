@@ -0,0 +1,147 @@
+package opns
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+)
+
+// Root is a namespace of names descending from one genesis contract. Each
+// root is indexed by its own topic manager and lookup service, with its keys
+// kept apart by Namespace.
+type Root struct {
+	Name       string
+	Topic      string
+	Service    string
+	Genesis    *overlay.Outpoint
+	Contract   []byte
+	Difficulty int
+	// Marker is the address pushed after every name inscription.
+	Marker    string
+	Namespace string
+}
+
+var DefaultRoot = &Root{
+	Name:       "OpNS",
+	Topic:      "tm_OpNS",
+	Service:    "ls_OpNS",
+	Genesis:    GENESIS,
+	Contract:   contract,
+	Difficulty: DIFFICULTY,
+	Marker:     "1opNSUJVbBc2Vf8LFNSoywGGK4jMcGVrC",
+}
+
+func (r *Root) Decode(s *script.Script) *Opns {
+	return r.decodeState(s, r.Genesis.TxBytes())
+}
+
+// DecodeGenesis reads the contract state of the root's genesis output, which
+// cannot reference its own txid.
+func (r *Root) DecodeGenesis(s *script.Script) *Opns {
+	return r.decodeState(s, nil)
+}
+
+// RootConfig is the JSON form of a root. Unset fields fall back to the
+// default root, except the namespace which defaults to the topic so that
+// roots never share keys.
+type RootConfig struct {
+	Name       string `json:"name"`
+	Topic      string `json:"topic"`
+	Service    string `json:"service,omitempty"`
+	Genesis    string `json:"genesis,omitempty"`
+	Contract   string `json:"contract,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	Marker     string `json:"marker,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// Root builds the root the config describes.
+func (cfg *RootConfig) Root() (*Root, error) {
+	root := &Root{
+		Name:       cfg.Name,
+		Topic:      cfg.Topic,
+		Service:    cfg.Service,
+		Genesis:    DefaultRoot.Genesis,
+		Contract:   DefaultRoot.Contract,
+		Difficulty: cfg.Difficulty,
+		Marker:     cfg.Marker,
+		Namespace:  cfg.Namespace,
+	}
+	var err error
+	if root.Topic == "" {
+		return nil, fmt.Errorf("root %q has no topic", cfg.Name)
+	}
+	if cfg.Genesis != "" {
+		if root.Genesis, err = overlay.NewOutpointFromString(cfg.Genesis); err != nil {
+			return nil, fmt.Errorf("root %s: invalid genesis: %w", root.Topic, err)
+		}
+	}
+	if cfg.Contract != "" {
+		if root.Contract, err = hex.DecodeString(cfg.Contract); err != nil {
+			return nil, fmt.Errorf("root %s: invalid contract: %w", root.Topic, err)
+		}
+	}
+	if root.Name == "" {
+		root.Name = root.Topic
+	}
+	if root.Service == "" {
+		root.Service = "ls_" + root.Topic
+	}
+	if root.Difficulty == 0 {
+		root.Difficulty = DefaultRoot.Difficulty
+	}
+	if root.Marker == "" {
+		root.Marker = DefaultRoot.Marker
+	}
+	if root.Namespace == "" {
+		root.Namespace = root.Topic + ":"
+	}
+	return root, nil
+}
+
+// Config returns the JSON form of the root.
+func (r *Root) Config() *RootConfig {
+	return &RootConfig{
+		Name:       r.Name,
+		Topic:      r.Topic,
+		Service:    r.Service,
+		Genesis:    r.Genesis.String(),
+		Contract:   hex.EncodeToString(r.Contract),
+		Difficulty: r.Difficulty,
+		Marker:     r.Marker,
+		Namespace:  r.Namespace,
+	}
+}
+
+// LoadRoots reads extra roots from a JSON file of RootConfig and returns
+// them after the default root.
+func LoadRoots(path string) ([]*Root, error) {
+	roots := []*Root{DefaultRoot}
+	if path == "" {
+		return roots, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*RootConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{DefaultRoot.Topic: {}}
+	for _, cfg := range configs {
+		root, err := cfg.Root()
+		if err != nil {
+			return nil, err
+		} else if _, ok := seen[root.Topic]; ok {
+			return nil, fmt.Errorf("duplicate root topic %s", root.Topic)
+		}
+		seen[root.Topic] = struct{}{}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
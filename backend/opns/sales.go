@@ -0,0 +1,388 @@
+package opns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction/chaintracker/headers_client"
+	"github.com/redis/go-redis/v9"
+)
+
+type HeaderSource interface {
+	BlockByHeight(ctx context.Context, height uint32) (*headers_client.Header, error)
+}
+
+var SalesKey = "mkt:sales"
+var SalesRecentKey = "mkt:sales:recent"
+var SalesPriceKey = "mkt:sales:price"
+
+// SalesVolumeKey and SalesCountKey total sales by UTC day.
+var SalesVolumeKey = "mkt:sales:vol"
+var SalesCountKey = "mkt:sales:cnt"
+
+// SalesLengthsKey is the set of domain lengths with sales.
+var SalesLengthsKey = "mkt:sales:lens"
+
+// SalesUntimedKey holds confirmed sales still stamped with the time they were
+// seen rather than their block time, scored by height.
+var SalesUntimedKey = "mkt:sales:untimed"
+
+// SalesLengthKey holds the sales of domains of length n, scored by price.
+func SalesLengthKey(n int) string {
+	return fmt.Sprintf("mkt:sales:len:%d", n)
+}
+
+type Sale struct {
+	Outpoint string `json:"outpoint"`
+	Listing  string `json:"listing"`
+	Domain   string `json:"domain"`
+	Price    uint64 `json:"price"`
+	Seller   string `json:"seller"`
+	Buyer    string `json:"buyer"`
+	Height   uint32 `json:"height"`
+	Idx      uint64 `json:"idx"`
+	Time     int64  `json:"time"`
+}
+
+type DailyVolume struct {
+	Day    string `json:"day"`
+	Volume uint64 `json:"volume"`
+	Sales  int    `json:"sales"`
+}
+
+type LengthMedian struct {
+	Length int    `json:"length"`
+	Median uint64 `json:"median"`
+	Sales  int    `json:"sales"`
+}
+
+// blockTime returns the timestamp of the block at height.
+func (l *LookupService) blockTime(ctx context.Context, height uint32) (int64, error) {
+	if header, err := l.headers.BlockByHeight(ctx, height); err != nil {
+		return 0, err
+	} else {
+		return int64(header.Timestamp), nil
+	}
+}
+
+// SaveSale records a sale and adds it to the daily and per-length totals. A
+// sale is stamped with the time it is seen; confirmed sales are queued for
+// WatchSaleTimes to move to their block time, keeping header lookups out of
+// admission.
+func (l *LookupService) SaveSale(ctx context.Context, sale *Sale) error {
+	return l.saveSale(ctx, sale, sale.Height > 0 && l.headers != nil)
+}
+
+func (l *LookupService) saveSale(ctx context.Context, sale *Sale, untimed bool) error {
+	if sale.Time == 0 {
+		sale.Time = time.Now().Unix()
+	}
+	saleJson, err := json.Marshal(sale)
+	if err != nil {
+		return err
+	}
+	return l.watchSales(ctx, func(tx *redis.Tx) error {
+		prev, err := l.findSale(ctx, tx, sale.Outpoint)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			if prev != nil {
+				l.removeSaleTotals(ctx, p, prev)
+			}
+			p.HSet(ctx, l.key(SalesKey), sale.Outpoint, saleJson)
+			p.ZAdd(ctx, l.key(SalesRecentKey), redis.Z{
+				Score:  HeightScore(sale.Height, sale.Idx),
+				Member: sale.Outpoint,
+			})
+			p.ZAdd(ctx, l.key(SalesPriceKey), redis.Z{
+				Score:  float64(sale.Price),
+				Member: sale.Outpoint,
+			})
+			l.addSaleTotals(ctx, p, sale)
+			if untimed {
+				p.ZAdd(ctx, l.key(SalesUntimedKey), redis.Z{
+					Score:  float64(sale.Height),
+					Member: sale.Outpoint,
+				})
+			} else {
+				p.ZRem(ctx, l.key(SalesUntimedKey), sale.Outpoint)
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// watchSales runs fn in a transaction watching the recorded sales, retrying
+// while another write to them gets in first, so totals are never adjusted
+// from a stale sale.
+func (l *LookupService) watchSales(ctx context.Context, fn func(tx *redis.Tx) error) error {
+	for {
+		if err := l.db.Watch(ctx, fn, l.key(SalesKey)); err != redis.TxFailedErr {
+			return err
+		}
+	}
+}
+
+func saleDay(sale *Sale) string {
+	return time.Unix(sale.Time, 0).UTC().Format(time.DateOnly)
+}
+
+func (l *LookupService) addSaleTotals(ctx context.Context, p redis.Pipeliner, sale *Sale) {
+	day := saleDay(sale)
+	p.HIncrBy(ctx, l.key(SalesVolumeKey), day, int64(sale.Price))
+	p.HIncrBy(ctx, l.key(SalesCountKey), day, 1)
+	p.ZAdd(ctx, l.key(SalesLengthKey(len(sale.Domain))), redis.Z{
+		Score:  float64(sale.Price),
+		Member: sale.Outpoint,
+	})
+	p.SAdd(ctx, l.key(SalesLengthsKey), len(sale.Domain))
+}
+
+func (l *LookupService) removeSaleTotals(ctx context.Context, p redis.Pipeliner, sale *Sale) {
+	day := saleDay(sale)
+	p.HIncrBy(ctx, l.key(SalesVolumeKey), day, -int64(sale.Price))
+	p.HIncrBy(ctx, l.key(SalesCountKey), day, -1)
+	p.ZRem(ctx, l.key(SalesLengthKey(len(sale.Domain))), sale.Outpoint)
+}
+
+// RebuildSaleTotals recomputes the daily and per-length totals from the
+// recorded sales. It is run once for indexes written before the totals were
+// kept.
+func (l *LookupService) RebuildSaleTotals(ctx context.Context) error {
+	if kept, err := l.db.Exists(ctx, l.key(SalesVolumeKey)).Result(); err != nil || kept > 0 {
+		return err
+	}
+	sales, err := l.db.HGetAll(ctx, l.key(SalesKey)).Result()
+	if err != nil || len(sales) == 0 {
+		return err
+	}
+	_, err = l.db.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, saleJson := range sales {
+			sale := &Sale{}
+			if err := json.Unmarshal([]byte(saleJson), sale); err != nil {
+				return err
+			}
+			l.addSaleTotals(ctx, p, sale)
+		}
+		return nil
+	})
+	log.Printf("Rebuilt sale totals from %d sales", len(sales))
+	return err
+}
+
+// TimeSales stamps queued sales with their block time.
+func (l *LookupService) TimeSales(ctx context.Context) error {
+	ops, err := l.db.ZRange(ctx, l.key(SalesUntimedKey), 0, 99).Result()
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if outpoint, err := overlay.NewOutpointFromString(op); err != nil {
+			return err
+		} else if sale, err := l.FindSale(ctx, outpoint); err != nil {
+			return err
+		} else if sale == nil || sale.Height == 0 {
+			if err := l.db.ZRem(ctx, l.key(SalesUntimedKey), op).Err(); err != nil {
+				return err
+			}
+		} else if sale.Time, err = l.blockTime(ctx, sale.Height); err != nil {
+			return err
+		} else if err := l.saveSale(ctx, sale, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchSaleTimes runs TimeSales on every tick until ctx is cancelled.
+func (l *LookupService) WatchSaleTimes(ctx context.Context, interval time.Duration) {
+	if l.headers == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.TimeSales(ctx); err != nil {
+				log.Printf("Error timing sales: %v", err)
+			}
+		}
+	}
+}
+
+func (l *LookupService) FindSale(ctx context.Context, outpoint *overlay.Outpoint) (*Sale, error) {
+	return l.findSale(ctx, l.db, outpoint.String())
+}
+
+func (l *LookupService) findSale(ctx context.Context, db redis.Cmdable, op string) (*Sale, error) {
+	if saleJson, err := db.HGet(ctx, l.key(SalesKey), op).Bytes(); err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		sale := &Sale{}
+		if err := json.Unmarshal(saleJson, sale); err != nil {
+			return nil, err
+		}
+		return sale, nil
+	}
+}
+
+func (l *LookupService) DeleteSale(ctx context.Context, outpoint *overlay.Outpoint) error {
+	op := outpoint.String()
+	return l.watchSales(ctx, func(tx *redis.Tx) error {
+		sale, err := l.findSale(ctx, tx, op)
+		if err != nil || sale == nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			l.removeSaleTotals(ctx, p, sale)
+			p.HDel(ctx, l.key(SalesKey), op)
+			p.ZRem(ctx, l.key(SalesRecentKey), op)
+			p.ZRem(ctx, l.key(SalesPriceKey), op)
+			p.ZRem(ctx, l.key(SalesUntimedKey), op)
+			return nil
+		})
+		return err
+	})
+}
+
+// updateSaleHeight moves a recorded sale to the block it confirmed in.
+func (l *LookupService) updateSaleHeight(ctx context.Context, outpoint *overlay.Outpoint, height uint32, idx uint64) error {
+	if sale, err := l.FindSale(ctx, outpoint); err != nil || sale == nil {
+		return err
+	} else {
+		sale.Height = height
+		sale.Idx = idx
+		return l.SaveSale(ctx, sale)
+	}
+}
+
+func (l *LookupService) loadSales(ctx context.Context, ops []string) ([]*Sale, error) {
+	if len(ops) == 0 {
+		return []*Sale{}, nil
+	}
+	items, err := l.db.HMGet(ctx, l.key(SalesKey), ops...).Result()
+	if err != nil {
+		return nil, err
+	}
+	sales := make([]*Sale, 0, len(items))
+	for _, item := range items {
+		if saleJson, ok := item.(string); !ok {
+			continue
+		} else {
+			sale := &Sale{}
+			if err := json.Unmarshal([]byte(saleJson), sale); err != nil {
+				return nil, err
+			}
+			sales = append(sales, sale)
+		}
+	}
+	return sales, nil
+}
+
+// FindSales returns sales newest first.
+func (l *LookupService) FindSales(ctx context.Context, offset int, limit int) ([]*Sale, error) {
+	if ops, err := l.db.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:   l.key(SalesRecentKey),
+		Start: offset,
+		Stop:  offset + limit - 1,
+		Rev:   true,
+	}).Result(); err != nil {
+		return nil, err
+	} else {
+		return l.loadSales(ctx, ops)
+	}
+}
+
+// TopSales returns the highest priced sales.
+func (l *LookupService) TopSales(ctx context.Context, limit int) ([]*Sale, error) {
+	if ops, err := l.db.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:   l.key(SalesPriceKey),
+		Start: 0,
+		Stop:  limit - 1,
+		Rev:   true,
+	}).Result(); err != nil {
+		return nil, err
+	} else {
+		return l.loadSales(ctx, ops)
+	}
+}
+
+// VolumePerDay totals sales by UTC day for days ending on or after since.
+func (l *LookupService) VolumePerDay(ctx context.Context, since time.Time) ([]*DailyVolume, error) {
+	volumes, err := l.db.HGetAll(ctx, l.key(SalesVolumeKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	counts, err := l.db.HGetAll(ctx, l.key(SalesCountKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	first := since.UTC().Format(time.DateOnly)
+	days := make([]*DailyVolume, 0, len(counts))
+	for day, countStr := range counts {
+		count, _ := strconv.Atoi(countStr)
+		volume, _ := strconv.ParseUint(volumes[day], 10, 64)
+		if day < first || count <= 0 {
+			continue
+		}
+		days = append(days, &DailyVolume{Day: day, Volume: volume, Sales: count})
+	}
+	slices.SortFunc(days, func(a, b *DailyVolume) int {
+		return strings.Compare(a.Day, b.Day)
+	})
+	return days, nil
+}
+
+// MedianPriceByLength groups sales by domain length and reports the median
+// sale price of each group.
+func (l *LookupService) MedianPriceByLength(ctx context.Context) ([]*LengthMedian, error) {
+	lengths, err := l.db.SMembers(ctx, l.key(SalesLengthsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+	medians := make([]*LengthMedian, 0, len(lengths))
+	for _, lengthStr := range lengths {
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil {
+			continue
+		}
+		key := l.key(SalesLengthKey(length))
+		count, err := l.db.ZCard(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		} else if count == 0 {
+			continue
+		}
+		middle, err := l.db.ZRangeWithScores(ctx, key, (count-1)/2, count/2).Result()
+		if err != nil {
+			return nil, err
+		}
+		median := uint64(middle[0].Score)
+		if len(middle) == 2 {
+			median = (uint64(middle[0].Score) + uint64(middle[1].Score)) / 2
+		}
+		medians = append(medians, &LengthMedian{
+			Length: length,
+			Median: median,
+			Sales:  int(count),
+		})
+	}
+	slices.SortFunc(medians, func(a, b *LengthMedian) int {
+		return a.Length - b.Length
+	})
+	return medians, nil
+}
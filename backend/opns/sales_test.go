@@ -0,0 +1,61 @@
+package opns
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/overlay"
+)
+
+// saleTotals returns the sales volume and count of day.
+func saleTotals(t *testing.T, l *LookupService, day string) (int64, int64) {
+	t.Helper()
+	ctx := context.Background()
+	vol, _ := l.db.HGet(ctx, l.key(SalesVolumeKey), day).Int64()
+	cnt, _ := l.db.HGet(ctx, l.key(SalesCountKey), day).Int64()
+	return vol, cnt
+}
+
+func TestSaveSaleConcurrent(t *testing.T) {
+	l, _ := newTestLookup(t, DefaultRoot)
+	ctx := context.Background()
+	op := &overlay.Outpoint{OutputIndex: 1}
+	sale := func(price uint64) *Sale {
+		return &Sale{Outpoint: op.String(), Domain: "abc", Price: price, Height: 100, Time: 1700000000}
+	}
+	day := saleDay(sale(0))
+
+	var wg sync.WaitGroup
+	for price := uint64(1); price <= 20; price++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.SaveSale(ctx, sale(price)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	// However the saves interleave, the sale is counted once, at the price
+	// it was last saved with.
+	if saved, err := l.FindSale(ctx, op); err != nil {
+		t.Fatal(err)
+	} else if vol, cnt := saleTotals(t, l, day); cnt != 1 || vol != int64(saved.Price) {
+		t.Errorf("totals %d over %d sales, want %d over 1", vol, cnt, saved.Price)
+	}
+
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.DeleteSale(ctx, op); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if vol, cnt := saleTotals(t, l, day); cnt != 0 || vol != 0 {
+		t.Errorf("totals %d over %d sales after deleting, want none", vol, cnt)
+	}
+}
@@ -2,10 +2,9 @@ package opns
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"encoding/binary"
-	"fmt"
+	"errors"
 	"math/big"
 	"runtime"
 
@@ -16,6 +15,7 @@ import (
 	"github.com/bsv-blockchain/go-sdk/util"
 )
 
+// DIFFICULTY is the number of leading zero bits required by the default root.
 const DIFFICULTY = 22
 
 var GENESIS, _ = overlay.NewOutpointFromString("58b7558ea379f24266c7e2f5fe321992ad9a724fd7a87423ba412677179ccb25_0")
@@ -33,6 +33,7 @@ type Opns struct {
 	Domain        string         `json:"domain"`
 	Pow           []byte         `json:"pow"`
 	LockingScript *script.Script `json:"lockingScript"`
+	root          *Root
 	solution      *Pow
 }
 
@@ -42,16 +43,31 @@ type OpnsUnlocker struct {
 	OwnerScript *script.Script `json:"ownerScript"`
 }
 
+// Decode reads a contract of the default root.
 func Decode(s *script.Script) *Opns {
-	if !bytes.HasPrefix(*s, contract) {
+	return DefaultRoot.Decode(s)
+}
+
+// Root returns the root the contract was decoded under.
+func (o *Opns) Root() *Root {
+	if o.root == nil {
+		return DefaultRoot
+	}
+	return o.root
+}
+
+// decodeState reads the contract state, requiring the genesis push to match
+// genesis. A nil genesis accepts any, as in the genesis output itself.
+func (r *Root) decodeState(s *script.Script, genesis []byte) *Opns {
+	if !bytes.HasPrefix(*s, r.Contract) {
 		return nil
 	}
-	pos := len(contract) + 2
+	pos := len(r.Contract) + 2
 
-	o := &Opns{}
+	o := &Opns{root: r}
 	if opGenesis, err := s.ReadOp(&pos); err != nil {
 		return nil
-	} else if !bytes.Equal(opGenesis.Data, GENESIS.TxBytes()) {
+	} else if genesis != nil && !bytes.Equal(opGenesis.Data, genesis) {
 		return nil
 	} else if opClaimed, err := s.ReadOp(&pos); err != nil {
 		return nil
@@ -68,9 +84,12 @@ func Decode(s *script.Script) *Opns {
 	return o
 }
 
-func (o *Opns) BuildUnlockTx(outpoint *overlay.Outpoint, char byte, ownerScript *script.Script) (*transaction.Transaction, error) {
+func (o *Opns) BuildUnlockTx(ctx context.Context, outpoint *overlay.Outpoint, char byte, ownerScript *script.Script) (*transaction.Transaction, error) {
 	tx := transaction.NewTransaction()
-	o.solution = o.Mine(char)
+	var err error
+	if o.solution, err = o.Mine(ctx, char); err != nil {
+		return nil, err
+	}
 	unlock, err := o.Unlock(char, ownerScript)
 	if err != nil {
 		return nil, err
@@ -84,21 +103,14 @@ func (o *Opns) BuildUnlockTx(outpoint *overlay.Outpoint, char byte, ownerScript
 		UnlockingScriptTemplate: unlock,
 	})
 
-	claimed := big.NewInt(0)
-	claimed.SetBytes(util.ReverseBytes(o.Claimed))
-	claimed.SetBit(claimed, int(char), 1)
-	claimedBytes := claimed.Bytes()
-	if claimedBytes[0]&0x80 != 0 {
-		claimedBytes = append([]byte{0x00}, claimedBytes...)
-	}
-	restateScript := Lock(util.ReverseBytes(claimedBytes), o.Domain, o.solution.Hash)
+	restateScript := o.Root().Lock(o.Claim(char), o.Domain, o.solution.Hash)
 	tx.AddOutput(&transaction.TransactionOutput{
 		LockingScript: restateScript,
 		Satoshis:      1,
 	})
 
 	newDomain := o.Domain + string(char)
-	newScript := Lock([]byte{0x00}, newDomain, o.solution.Hash)
+	newScript := o.Root().Lock([]byte{0x00}, newDomain, o.solution.Hash)
 	// log.Printf("newScript: %x\n", *newScript)
 	// log.Printf("restateScript: %x\n", *restateScript)
 	tx.AddOutput(&transaction.TransactionOutput{
@@ -112,7 +124,29 @@ func (o *Opns) BuildUnlockTx(outpoint *overlay.Outpoint, char byte, ownerScript
 	return tx, nil
 }
 
+// IsClaimed reports whether char has already been claimed under the domain.
+func (o *Opns) IsClaimed(char byte) bool {
+	claimed := new(big.Int).SetBytes(util.ReverseBytes(o.Claimed))
+	return claimed.Bit(int(char)) == 1
+}
+
+// Claim returns the claimed bitmap with char added, encoded as a script number.
+func (o *Opns) Claim(char byte) []byte {
+	claimed := big.NewInt(0)
+	claimed.SetBytes(util.ReverseBytes(o.Claimed))
+	claimed.SetBit(claimed, int(char), 1)
+	claimedBytes := claimed.Bytes()
+	if claimedBytes[0]&0x80 != 0 {
+		claimedBytes = append([]byte{0x00}, claimedBytes...)
+	}
+	return util.ReverseBytes(claimedBytes)
+}
+
 func (o *Opns) BuildInscription(domain string, ownerScript *script.Script) *script.Script {
+	return o.Root().BuildInscription(domain, ownerScript)
+}
+
+func (r *Root) BuildInscription(domain string, ownerScript *script.Script) *script.Script {
 	lockingScript := script.NewFromBytes(*ownerScript)
 	lockingScript.AppendOpcodes(script.OpFALSE, script.OpIF)
 	lockingScript.AppendPushData([]byte("ord"))
@@ -121,15 +155,20 @@ func (o *Opns) BuildInscription(domain string, ownerScript *script.Script) *scri
 	lockingScript.AppendOpcodes(script.Op0)
 	lockingScript.AppendPushData([]byte(domain))
 	lockingScript.AppendOpcodes(script.OpENDIF, script.OpRETURN)
-	lockingScript.AppendPushData([]byte("1opNSUJVbBc2Vf8LFNSoywGGK4jMcGVrC"))
-	lockingScript.AppendPushData(GENESIS.TxBytes())
+	lockingScript.AppendPushData([]byte(r.Marker))
+	lockingScript.AppendPushData(r.Genesis.TxBytes())
 	return lockingScript
 }
 
+// Lock builds a contract of the default root.
 func Lock(claimed []byte, domain string, pow []byte) *script.Script {
+	return DefaultRoot.Lock(claimed, domain, pow)
+}
+
+func (r *Root) Lock(claimed []byte, domain string, pow []byte) *script.Script {
 	state := script.NewFromBytes([]byte{})
 	state.AppendOpcodes(script.OpRETURN, script.OpFALSE)
-	state.AppendPushData(GENESIS.TxBytes())
+	state.AppendPushData(r.Genesis.TxBytes())
 	state.AppendPushData(claimed)
 	state.AppendPushData([]byte(domain))
 	state.AppendPushData(pow)
@@ -137,9 +176,9 @@ func Lock(claimed []byte, domain string, pow []byte) *script.Script {
 	stateScript := binary.LittleEndian.AppendUint32(*state, stateSize)
 	stateScript = append(stateScript, 0x00)
 
-	s := make([]byte, len(contract)+len(stateScript))
-	copy(s, contract)
-	copy(s[len(contract):], stateScript)
+	s := make([]byte, len(r.Contract)+len(stateScript))
+	copy(s, r.Contract)
+	copy(s[len(r.Contract):], stateScript)
 	lockingScript := script.NewFromBytes(s)
 	return lockingScript
 }
@@ -153,53 +192,17 @@ func (o *Opns) Unlock(char byte, ownerScript *script.Script) (*OpnsUnlocker, err
 	return unlock, nil
 }
 
-func (o *Opns) Mine(char byte) *Pow {
-	CONCURRENCY := runtime.NumCPU()
-	limit := make(chan struct{}, CONCURRENCY)
-	done := make(chan *Pow)
-	counter := uint(0)
-	for {
-		select {
-		case nonce := <-done:
-			return nonce
-		default:
-			limit <- struct{}{}
-			go func() {
-				test := append([]byte{}, o.Pow...)
-				test = append(test, char)
-				nonce := make([]byte, 32)
-				counter++
-				rand.Read(nonce)
-				// nonce, _ := hex.DecodeString("3ffd296edebfae7f")
-				test = append(test, nonce...)
-
-				hash := sha256.Sum256(test)
-				hash = sha256.Sum256(hash[:])
-
-				testInt := new(big.Int).SetBytes(util.ReverseBytes(hash[:]))
-				testInt = testInt.Rsh(testInt, uint(256-DIFFICULTY))
-				<-limit
-				if testInt.Cmp(comp) == 0 {
-					fmt.Printf("Test: %b %x\n", testInt, util.ReverseBytes(hash[:]))
-					fmt.Printf("Found: %x\n", nonce)
-					done <- &Pow{
-						Nonce:  nonce,
-						Hash:   hash[:],
-						Hashes: uint64(counter),
-					}
-
-				}
-			}()
-		}
-	}
+// Mine finds a solution for char at the root's difficulty using every CPU.
+func (o *Opns) Mine(ctx context.Context, char byte) (*Pow, error) {
+	return NewMiner(o.Root().Difficulty, runtime.NumCPU()).Mine(ctx, o.Pow, char)
 }
 
-func (o *OpnsUnlocker) Sign(tx *transaction.Transaction, inputIndex uint32) (*script.Script, error) {
+// unlockScript builds the claim unlock. The contract only commits to the
+// outputs after the three it creates.
+func (o *OpnsUnlocker) unlockScript(tx *transaction.Transaction, inputIndex uint32, nonce []byte) (*script.Script, error) {
 	unlockScript := &script.Script{}
-
-	// pow := o.Mine(o.Char)
 	unlockScript.AppendPushData([]byte{o.Char})
-	unlockScript.AppendPushData([]byte(o.solution.Nonce))
+	unlockScript.AppendPushData(nonce)
 	unlockScript.AppendPushData(*o.OwnerScript)
 	trailingOutputs := []byte{}
 	if len(tx.Outputs) > 3 {
@@ -216,23 +219,24 @@ func (o *OpnsUnlocker) Sign(tx *transaction.Transaction, inputIndex uint32) (*sc
 	return unlockScript, nil
 }
 
-func (o *OpnsUnlocker) EstimateLength(tx *transaction.Transaction, inputIndex uint32) uint32 {
-	trailingOutputs := []byte{}
-	if len(tx.Outputs) > 2 {
-		for _, output := range tx.Outputs[2:] {
-			trailingOutputs = append(trailingOutputs, output.Bytes()...)
-		}
+func (o *OpnsUnlocker) Sign(tx *transaction.Transaction, inputIndex uint32) (*script.Script, error) {
+	if o.solution == nil {
+		return nil, errors.New("claim has not been mined")
 	}
-	toPrefix, _ := script.PushDataPrefix(trailingOutputs)
-	osPrefix, _ := script.PushDataPrefix(*o.OwnerScript)
-	preimage, _ := tx.CalcInputPreimage(inputIndex, sighash.AnyOneCanPayForkID)
-	preimagePrefix, _ := script.PushDataPrefix(preimage)
-
-	return uint32(len(contract) +
-		4 + // OP_RETURN isGenesis push char
-		33 + // push data nonce
-		len(osPrefix) + len(*o.OwnerScript) + // push data ownerScript
-		len(toPrefix) + len(trailingOutputs) + // push data trailingOutputs
-		len(preimagePrefix) + len(preimage)) // push data preimage
+	return o.unlockScript(tx, inputIndex, o.solution.Nonce)
+}
 
+// EstimateLength builds the unlock with a placeholder nonce as long as the
+// mined one. Before mining it assumes a 32 byte nonce, which a shorter nonce
+// found later only makes an overestimate.
+func (o *OpnsUnlocker) EstimateLength(tx *transaction.Transaction, inputIndex uint32) uint32 {
+	nonceLen := 32
+	if o.solution != nil {
+		nonceLen = len(o.solution.Nonce)
+	}
+	if unlockScript, err := o.unlockScript(tx, inputIndex, make([]byte, nonceLen)); err != nil {
+		return 0
+	} else {
+		return uint32(len(*unlockScript))
+	}
 }
@@ -0,0 +1,72 @@
+package opns
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// ownerScripts covers each owner type and the push data size boundaries.
+func ownerScripts(rng *rand.Rand) map[string]*script.Script {
+	p2pkh, _ := script.NewFromHex("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+	p2pk, _ := script.NewFromHex("21020102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20ac")
+	multisig, _ := script.NewFromHex("5121020102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021030102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2052ae")
+	scripts := map[string]*script.Script{
+		"p2pkh":    p2pkh,
+		"p2pk":     p2pk,
+		"multisig": multisig,
+	}
+	for _, n := range []int{1, 75, 76, 255, 256, 65535, 65536} {
+		scripts[fmt.Sprintf("custom-%d", n)] = randomScript(rng, n)
+	}
+	return scripts
+}
+
+func randomScript(rng *rand.Rand, n int) *script.Script {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = byte(rng.Uint32())
+	}
+	return script.NewFromBytes(s)
+}
+
+func TestOpnsUnlockerEstimateLength(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	lock := Lock([]byte{0x00}, "", claimPow)
+	o := Decode(lock)
+	for _, nonceLen := range []int{8, 32, 64} {
+		o.solution = &Pow{Nonce: bytes.Repeat([]byte{0x42}, nonceLen), Hash: claimPow}
+		for name, owner := range ownerScripts(rng) {
+			for trailing := 0; trailing <= 5; trailing++ {
+				unlock, err := o.Unlock('a', owner)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tx := transaction.NewTransaction()
+				tx.AddInputsFromUTXOs(&transaction.UTXO{
+					TxID:                    (&transaction.Transaction{}).TxID(),
+					LockingScript:           lock,
+					Satoshis:                1,
+					UnlockingScriptTemplate: unlock,
+				})
+				for i := 0; i < 3+trailing; i++ {
+					tx.AddOutput(&transaction.TransactionOutput{
+						LockingScript: randomScript(rng, rng.IntN(300)),
+						Satoshis:      rng.Uint64N(1e8),
+					})
+				}
+
+				estimate := unlock.EstimateLength(tx, 0)
+				if signed, err := unlock.Sign(tx, 0); err != nil {
+					t.Fatal(err)
+				} else if int(estimate) != len(*signed) {
+					t.Errorf("%d byte nonce, %s with %d trailing outputs: estimated %d, signed %d", nonceLen, name, trailing, estimate, len(*signed))
+				}
+			}
+		}
+	}
+}
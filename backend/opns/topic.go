@@ -3,12 +3,29 @@ package opns
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
 
 	"github.com/bsv-blockchain/go-sdk/overlay"
 	"github.com/bsv-blockchain/go-sdk/transaction"
 )
 
-type TopicManager struct{}
+// TopicManager admits the outputs of one root. A zero TopicManager uses the
+// default root.
+type TopicManager struct {
+	Root *Root
+}
+
+func NewTopicManager(root *Root) *TopicManager {
+	return &TopicManager{Root: root}
+}
+
+func (tm *TopicManager) root() *Root {
+	if tm.Root == nil {
+		return DefaultRoot
+	}
+	return tm.Root
+}
 
 func (tm *TopicManager) IdentifyAdmissableOutputs(ctx context.Context, beefBytes []byte, previousCoins []uint32) (admit overlay.AdmittanceInstructions, err error) {
 	_, tx, txid, err := transaction.ParseBeef(beefBytes)
@@ -18,8 +35,9 @@ func (tm *TopicManager) IdentifyAdmissableOutputs(ctx context.Context, beefBytes
 		return admit, errors.New("transaction is nil")
 	}
 
-	if txid.Equal(GENESIS.Txid) {
-		admit.OutputsToAdmit = append(admit.OutputsToAdmit, 0)
+	root := tm.root()
+	if txid.Equal(root.Genesis.Txid) {
+		admit.OutputsToAdmit = append(admit.OutputsToAdmit, root.Genesis.OutputIndex)
 		return
 	}
 	if len(previousCoins) == 0 {
@@ -27,10 +45,20 @@ func (tm *TopicManager) IdentifyAdmissableOutputs(ctx context.Context, beefBytes
 	}
 
 	ancillaryTxids := make(map[string]struct{})
-	for vin := range previousCoins {
+	for _, vin := range previousCoins {
 		sourceOutput := tx.Inputs[vin].SourceTxOutput()
 		ancillaryTxids[tx.Inputs[vin].SourceTXID.String()] = struct{}{}
-		if o := Decode(sourceOutput.LockingScript); o != nil || tx.Inputs[vin].SourceTXID.Equal(GENESIS.Txid) {
+		var o *Opns
+		if tx.Inputs[vin].SourceTXID.Equal(root.Genesis.Txid) {
+			o = root.DecodeGenesis(sourceOutput.LockingScript)
+		} else {
+			o = root.Decode(sourceOutput.LockingScript)
+		}
+		if o != nil {
+			if err := ValidateClaim(tx, vin, o); err != nil {
+				log.Printf("Rejecting claim %s: %v", txid, err)
+				return admit, nil
+			}
 			admit.CoinsToRetain = previousCoins
 			admit.OutputsToAdmit = []uint32{0, 1, 2}
 			return
@@ -65,11 +93,13 @@ func (tm *TopicManager) IdentifyNeededInputs(ctx context.Context, beefBytes []by
 }
 
 func (tm *TopicManager) GetDocumentation() string {
-	return "OpNS Topic Manager"
+	return tm.root().Name + " Topic Manager"
 }
 
 func (tm *TopicManager) GetMetaData() *overlay.MetaData {
+	root := tm.root()
 	return &overlay.MetaData{
-		Name: "OpNS",
+		Name:        root.Name,
+		Description: fmt.Sprintf("%s names descending from %s at difficulty %d", root.Name, root.Genesis, root.Difficulty),
 	}
 }
@@ -0,0 +1,313 @@
+package opns
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bitcoin-sv/go-templates/template/ordlock"
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	sighash "github.com/bsv-blockchain/go-sdk/transaction/sighash"
+	"github.com/bsv-blockchain/go-sdk/transaction/template/p2pkh"
+)
+
+// DefaultFeeRate is in satoshis per kilobyte.
+const DefaultFeeRate = 1
+
+var ErrNameNotFound = errors.New("name not found")
+var ErrNotListed = errors.New("name is not listed")
+var ErrListed = errors.New("name is listed")
+var ErrInvalidTrade = errors.New("invalid trade")
+
+// p2pkhUnlockLength is the size of a signature and compressed pubkey push.
+const p2pkhUnlockLength = 106
+
+type Funding struct {
+	Txid     string `json:"txid"`
+	Vout     uint32 `json:"vout"`
+	Script   string `json:"script"`
+	Satoshis uint64 `json:"satoshis"`
+}
+
+// TradeRequest describes a trade of a name. Address is the recipient of a
+// transfer or cancel, the payout address of a listing and the buyer of a
+// purchase.
+type TradeRequest struct {
+	Domain        string     `json:"domain"`
+	Address       string     `json:"address"`
+	Price         uint64     `json:"price,omitempty"`
+	Funding       []*Funding `json:"funding"`
+	ChangeAddress string     `json:"changeAddress"`
+	FeeRate       uint64     `json:"feeRate,omitempty"`
+}
+
+// UnsignedTx is a built trade. Input 0 spends the name and output 0 receives
+// it. Every other input is left for the wallet to sign; EF carries the source
+// outputs it needs to do so.
+type UnsignedTx struct {
+	RawTx string `json:"rawtx"`
+	EF    string `json:"ef"`
+	Fee   uint64 `json:"fee"`
+}
+
+// unsigned reserves space for an unlocking script the wallet will provide.
+type unsigned struct {
+	length uint32
+}
+
+func (u *unsigned) Sign(tx *transaction.Transaction, inputIndex uint32) (*script.Script, error) {
+	return nil, errors.New("input must be signed by the wallet")
+}
+
+func (u *unsigned) EstimateLength(tx *transaction.Transaction, inputIndex uint32) uint32 {
+	return u.length
+}
+
+// OrdLockPurchase unlocks an ordlock listing by paying the seller. It needs no
+// key, so the builder signs it once the outputs are final.
+type OrdLockPurchase struct{}
+
+func (p *OrdLockPurchase) trailingOutputs(tx *transaction.Transaction) []byte {
+	trailing := []byte{}
+	if len(tx.Outputs) > 2 {
+		for _, output := range tx.Outputs[2:] {
+			trailing = append(trailing, output.Bytes()...)
+		}
+	}
+	return trailing
+}
+
+func (p *OrdLockPurchase) Sign(tx *transaction.Transaction, inputIndex uint32) (*script.Script, error) {
+	unlockScript := &script.Script{}
+	unlockScript.AppendPushData(tx.Outputs[0].Bytes())
+	if trailing := p.trailingOutputs(tx); len(trailing) > 0 {
+		unlockScript.AppendPushData(trailing)
+	} else {
+		unlockScript.AppendOpcodes(script.Op0)
+	}
+	if preimage, err := tx.CalcInputPreimage(inputIndex, sighash.All|sighash.AnyOneCanPayForkID); err != nil {
+		return nil, err
+	} else {
+		unlockScript.AppendPushData(preimage)
+	}
+	unlockScript.AppendOpcodes(script.Op0)
+	return unlockScript, nil
+}
+
+func (p *OrdLockPurchase) EstimateLength(tx *transaction.Transaction, inputIndex uint32) uint32 {
+	ordOutput := tx.Outputs[0].Bytes()
+	ordPrefix, _ := script.PushDataPrefix(ordOutput)
+	trailing := p.trailingOutputs(tx)
+	trailingLength := 1
+	if len(trailing) > 0 {
+		trailingPrefix, _ := script.PushDataPrefix(trailing)
+		trailingLength = len(trailingPrefix) + len(trailing)
+	}
+	preimage, _ := tx.CalcInputPreimage(inputIndex, sighash.All|sighash.AnyOneCanPayForkID)
+	preimagePrefix, _ := script.PushDataPrefix(preimage)
+	return uint32(len(ordPrefix) + len(ordOutput) +
+		trailingLength +
+		len(preimagePrefix) + len(preimage) +
+		1) // OP_0 selects the purchase branch
+}
+
+// OrdLockScript locks an ordinal for sale to anyone paying payout, or for
+// cancellation by the holder of seller.
+func OrdLockScript(seller *script.Address, payout *transaction.TransactionOutput) *script.Script {
+	s := script.NewFromBytes(ordlock.OrdLockPrefix)
+	s.AppendPushData(seller.PublicKeyHash)
+	s.AppendPushData(payout.Bytes())
+	*s = append(*s, ordlock.OrdLockSuffix...)
+	return s
+}
+
+// CurrentOutput returns the unspent output currently holding domain.
+func (l *LookupService) CurrentOutput(ctx context.Context, domain string) (*Name, *engine.Output, error) {
+	if ops, err := l.db.ZRevRange(ctx, l.key(EventKey("opns:"+domain)), 0, 0).Result(); err != nil {
+		return nil, nil, err
+	} else if len(ops) == 0 {
+		return nil, nil, ErrNameNotFound
+	} else if names, err := l.loadNames(ctx, ops); err != nil {
+		return nil, nil, err
+	} else if names[0] == nil {
+		return nil, nil, ErrNameNotFound
+	} else if outpoint, err := overlay.NewOutpointFromString(ops[0]); err != nil {
+		return nil, nil, err
+	} else if output, err := l.storage.FindOutput(ctx, outpoint, &l.topic, &engine.FALSE, false); err != nil {
+		return nil, nil, err
+	} else if output == nil {
+		return nil, nil, ErrNameNotFound
+	} else {
+		return names[0], output, nil
+	}
+}
+
+func p2pkhOutput(address string, satoshis uint64) (*transaction.TransactionOutput, error) {
+	if add, err := script.NewAddressFromString(address); err != nil {
+		return nil, fmt.Errorf("%w: invalid address %q: %v", ErrInvalidTrade, address, err)
+	} else if lockingScript, err := p2pkh.Lock(add); err != nil {
+		return nil, err
+	} else {
+		return &transaction.TransactionOutput{
+			LockingScript: lockingScript,
+			Satoshis:      satoshis,
+		}, nil
+	}
+}
+
+// buildTrade spends the name as input 0 into the given outputs and funds it
+// from the request.
+func buildTrade(req *TradeRequest, nameOutput *engine.Output, nameUnlock transaction.UnlockingScriptTemplate, outputs ...*transaction.TransactionOutput) (*transaction.Transaction, error) {
+	tx := transaction.NewTransaction()
+	if err := tx.AddInputsFromUTXOs(&transaction.UTXO{
+		TxID:                    &nameOutput.Outpoint.Txid,
+		Vout:                    nameOutput.Outpoint.OutputIndex,
+		LockingScript:           nameOutput.Script,
+		Satoshis:                nameOutput.Satoshis,
+		UnlockingScriptTemplate: nameUnlock,
+	}); err != nil {
+		return nil, err
+	}
+	for _, output := range outputs {
+		tx.AddOutput(output)
+	}
+	utxos := make([]*transaction.UTXO, 0, len(req.Funding))
+	for _, funding := range req.Funding {
+		if txid, err := chainhash.NewHashFromHex(funding.Txid); err != nil {
+			return nil, fmt.Errorf("%w: invalid funding txid %q: %v", ErrInvalidTrade, funding.Txid, err)
+		} else if lockingScript, err := script.NewFromHex(funding.Script); err != nil {
+			return nil, fmt.Errorf("%w: invalid funding script: %v", ErrInvalidTrade, err)
+		} else {
+			utxos = append(utxos, &transaction.UTXO{
+				TxID:                    txid,
+				Vout:                    funding.Vout,
+				LockingScript:           lockingScript,
+				Satoshis:                funding.Satoshis,
+				UnlockingScriptTemplate: &unsigned{length: p2pkhUnlockLength},
+			})
+		}
+	}
+	// Funding left over without somewhere to go would all be paid as fee.
+	if req.ChangeAddress == "" {
+		return nil, fmt.Errorf("%w: changeAddress is required", ErrInvalidTrade)
+	} else if change, err := p2pkhOutput(req.ChangeAddress, 0); err != nil {
+		return nil, err
+	} else if err := FundTx(tx, utxos, change.LockingScript, req.FeeRate); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func unsignedTx(tx *transaction.Transaction) (*UnsignedTx, error) {
+	if ef, err := tx.EFHex(); err != nil {
+		return nil, err
+	} else if fee, err := tx.GetFee(); err != nil {
+		return nil, err
+	} else {
+		return &UnsignedTx{
+			RawTx: tx.Hex(),
+			EF:    ef,
+			Fee:   fee,
+		}, nil
+	}
+}
+
+// BuildTransfer sends the name to req.Address.
+func (l *LookupService) BuildTransfer(ctx context.Context, req *TradeRequest) (*UnsignedTx, error) {
+	if name, output, err := l.CurrentOutput(ctx, req.Domain); err != nil {
+		return nil, err
+	} else if name.Listing != nil {
+		return nil, ErrListed
+	} else if ordOutput, err := p2pkhOutput(req.Address, 1); err != nil {
+		return nil, err
+	} else if tx, err := buildTrade(req, output, &unsigned{length: p2pkhUnlockLength}, ordOutput); err != nil {
+		return nil, err
+	} else {
+		return unsignedTx(tx)
+	}
+}
+
+// BuildListing locks the name in an ordlock for req.Price, paid to
+// req.Address or the current owner. The current owner can cancel it.
+func (l *LookupService) BuildListing(ctx context.Context, req *TradeRequest) (*UnsignedTx, error) {
+	name, output, err := l.CurrentOutput(ctx, req.Domain)
+	if err != nil {
+		return nil, err
+	} else if name.Listing != nil {
+		return nil, ErrListed
+	} else if req.Price == 0 {
+		return nil, fmt.Errorf("%w: price is required", ErrInvalidTrade)
+	}
+	payAddress := req.Address
+	if payAddress == "" {
+		payAddress = name.Owner
+	}
+	if seller, err := script.NewAddressFromString(name.Owner); err != nil {
+		return nil, fmt.Errorf("%w: name is not held by an address", ErrInvalidTrade)
+	} else if payout, err := p2pkhOutput(payAddress, req.Price); err != nil {
+		return nil, err
+	} else if tx, err := buildTrade(req, output, &unsigned{length: p2pkhUnlockLength}, &transaction.TransactionOutput{
+		LockingScript: OrdLockScript(seller, payout),
+		Satoshis:      1,
+	}); err != nil {
+		return nil, err
+	} else {
+		return unsignedTx(tx)
+	}
+}
+
+// BuildCancel returns a listed name to req.Address or the seller.
+func (l *LookupService) BuildCancel(ctx context.Context, req *TradeRequest) (*UnsignedTx, error) {
+	name, output, err := l.CurrentOutput(ctx, req.Domain)
+	if err != nil {
+		return nil, err
+	} else if name.Listing == nil {
+		return nil, ErrNotListed
+	}
+	address := req.Address
+	if address == "" {
+		address = name.Listing.Seller
+	}
+	if ordOutput, err := p2pkhOutput(address, 1); err != nil {
+		return nil, err
+	} else if tx, err := buildTrade(req, output, &unsigned{length: p2pkhUnlockLength + 1}, ordOutput); err != nil {
+		return nil, err
+	} else {
+		return unsignedTx(tx)
+	}
+}
+
+// BuildPurchase buys a listed name for req.Address. The listing input is
+// unlocked here; only the funding inputs are left for the wallet.
+func (l *LookupService) BuildPurchase(ctx context.Context, req *TradeRequest) (*UnsignedTx, error) {
+	name, output, err := l.CurrentOutput(ctx, req.Domain)
+	if err != nil {
+		return nil, err
+	} else if name.Listing == nil {
+		return nil, ErrNotListed
+	}
+	payoutBytes, err := hex.DecodeString(name.Listing.PayOut)
+	if err != nil {
+		return nil, err
+	}
+	payout := &transaction.TransactionOutput{}
+	if _, err := payout.ReadFrom(bytes.NewReader(payoutBytes)); err != nil {
+		return nil, err
+	}
+	purchase := &OrdLockPurchase{}
+	if ordOutput, err := p2pkhOutput(req.Address, 1); err != nil {
+		return nil, err
+	} else if tx, err := buildTrade(req, output, purchase, ordOutput, payout); err != nil {
+		return nil, err
+	} else if tx.Inputs[0].UnlockingScript, err = purchase.Sign(tx, 0); err != nil {
+		return nil, err
+	} else {
+		return unsignedTx(tx)
+	}
+}
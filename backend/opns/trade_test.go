@@ -0,0 +1,49 @@
+package opns
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+const tradeAddress = "1BoatSLRHtKNngkdXEeobR76b53LETtpyT"
+
+func tradeFixture(changeAddress string) (*TradeRequest, *engine.Output) {
+	req := &TradeRequest{
+		Domain:        "a",
+		Address:       tradeAddress,
+		Funding:       []*Funding{{Txid: (&transaction.Transaction{}).TxID().String(), Script: fundScript.String(), Satoshis: 10000}},
+		ChangeAddress: changeAddress,
+	}
+	output := &engine.Output{Script: fundScript, Satoshis: 1}
+	return req, output
+}
+
+func TestBuildTradeChange(t *testing.T) {
+	req, output := tradeFixture(tradeAddress)
+	ordOutput, err := p2pkhOutput(req.Address, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := buildTrade(req, output, &unsigned{length: p2pkhUnlockLength}, ordOutput)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(tx.Outputs) != 2 || !tx.Outputs[1].Change || tx.Outputs[1].Satoshis == 0 {
+		t.Fatalf("want the name output and change, got %d outputs", len(tx.Outputs))
+	} else if tx.Outputs[0].Satoshis != 1 {
+		t.Errorf("name output has %d sats", tx.Outputs[0].Satoshis)
+	}
+}
+
+func TestBuildTradeRequiresChange(t *testing.T) {
+	req, output := tradeFixture("")
+	ordOutput, err := p2pkhOutput(tradeAddress, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildTrade(req, output, &unsigned{length: p2pkhUnlockLength}, ordOutput); !errors.Is(err, ErrInvalidTrade) {
+		t.Errorf("got %v, want ErrInvalidTrade", err)
+	}
+}
@@ -0,0 +1,91 @@
+package opns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/script/interpreter"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// ValidateClaim checks that input vin of tx is a valid claim against the
+// OpNS contract o: the unlock must execute, the proof of work must meet the
+// difficulty, and outputs 0, 1 and 2 must restate the parent, mint the
+// extended domain and inscribe it to the claimant.
+func ValidateClaim(tx *transaction.Transaction, vin uint32, o *Opns) error {
+	input := tx.Inputs[vin]
+	sourceOutput := input.SourceTxOutput()
+	if sourceOutput == nil {
+		return errors.New("missing source output")
+	} else if err := interpreter.NewEngine().Execute(
+		interpreter.WithTx(tx, int(vin), sourceOutput),
+		interpreter.WithForkID(),
+		interpreter.WithAfterGenesis(),
+	); err != nil {
+		return fmt.Errorf("script execution failed: %w", err)
+	}
+	return checkClaim(tx, vin, o)
+}
+
+// checkClaim makes the checks of ValidateClaim that do not run the script.
+func checkClaim(tx *transaction.Transaction, vin uint32, o *Opns) error {
+	input := tx.Inputs[vin]
+	if len(tx.Outputs) < 3 {
+		return errors.New("claim must have at least 3 outputs")
+	}
+
+	// The contract hashes the nonce at whatever length it is pushed, so any
+	// length is valid as long as the hash meets the difficulty.
+	chunks, err := input.UnlockingScript.Chunks()
+	if err != nil {
+		return err
+	} else if len(chunks) < 3 || len(chunks[0].Data) != 1 {
+		return errors.New("malformed unlocking script")
+	}
+	char := chunks[0].Data[0]
+	nonce := chunks[1].Data
+	ownerScript := script.NewFromBytes(chunks[2].Data)
+	if o.IsClaimed(char) {
+		return fmt.Errorf("char %q already claimed", char)
+	}
+
+	test := append(append(append([]byte{}, o.Pow...), char), nonce...)
+	hash := sha256.Sum256(test)
+	hash = sha256.Sum256(hash[:])
+	root := o.Root()
+	if !MeetsDifficulty(hash[:], root.Difficulty) {
+		return errors.New("proof of work does not meet difficulty")
+	}
+
+	domain := o.Domain + string(char)
+	for vout, output := range tx.Outputs[:3] {
+		if output.Satoshis != 1 {
+			return fmt.Errorf("output %d must be 1 sat", vout)
+		}
+	}
+	if restate := root.Decode(tx.Outputs[0].LockingScript); restate == nil {
+		return errors.New("output 0 is not an OpNS contract")
+	} else if restate.Domain != o.Domain {
+		return errors.New("output 0 changes the domain")
+	} else if !bytes.Equal(restate.Claimed, o.Claim(char)) {
+		return errors.New("output 0 claimed bitmap does not add char")
+	} else if !bytes.Equal(restate.Pow, hash[:]) {
+		return errors.New("output 0 pow does not match")
+	}
+	if minted := root.Decode(tx.Outputs[1].LockingScript); minted == nil {
+		return errors.New("output 1 is not an OpNS contract")
+	} else if minted.Domain != domain {
+		return fmt.Errorf("output 1 domain %q does not extend %q by %q", minted.Domain, o.Domain, char)
+	} else if !bytes.Equal(minted.Claimed, []byte{0x00}) && len(minted.Claimed) != 0 {
+		return errors.New("output 1 must start with nothing claimed")
+	} else if !bytes.Equal(minted.Pow, hash[:]) {
+		return errors.New("output 1 pow does not match")
+	}
+	if !bytes.Equal(*tx.Outputs[2].LockingScript, *o.BuildInscription(domain, ownerScript)) {
+		return errors.New("output 2 inscription does not match")
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package opns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+)
+
+// claimPow is the parent proof of work of the fixture claims, and the nonces
+// below were mined for it and 'a' at DIFFICULTY.
+var claimPow = bytes.Repeat([]byte{0x11}, 32)
+
+const (
+	claimNonce      = "c1767a0000000000000000000000000000000000000000000000000000000000"
+	claimShortNonce = "d9d2120000000000"
+)
+
+var claimOwner, _ = script.NewFromHex("76a914000102030405060708090a0b0c0d0e0f1011121388ac")
+
+// buildClaim claims char under an unnamed contract with claimPow, letting
+// edit change the outputs before the unlock is built.
+func buildClaim(t *testing.T, claimed []byte, char byte, nonceHex string, edit func(tx *transaction.Transaction, hash []byte)) (*transaction.Transaction, *Opns) {
+	t.Helper()
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := claimHash(claimPow, char, nonce)
+
+	lock := Lock(claimed, "", claimPow)
+	source := transaction.NewTransaction()
+	source.AddOutput(&transaction.TransactionOutput{LockingScript: lock, Satoshis: 1})
+	o := Decode(lock)
+	if o == nil {
+		t.Fatal("fixture contract does not decode")
+	}
+
+	tx := transaction.NewTransaction()
+	tx.AddInputsFromUTXOs(&transaction.UTXO{
+		TxID:          source.TxID(),
+		Vout:          0,
+		LockingScript: lock,
+		Satoshis:      1,
+	})
+	tx.Inputs[0].SourceTransaction = source
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: Lock(o.Claim(char), "", hash), Satoshis: 1})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: Lock([]byte{0x00}, string(char), hash), Satoshis: 1})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: o.BuildInscription(string(char), claimOwner), Satoshis: 1})
+	if edit != nil {
+		edit(tx, hash)
+	}
+
+	unlock, err := o.Unlock(char, claimOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Inputs[0].UnlockingScript, err = unlock.unlockScript(tx, 0, nonce); err != nil {
+		t.Fatal(err)
+	}
+	return tx, o
+}
+
+func claimHash(pow []byte, char byte, nonce []byte) []byte {
+	hash := sha256.Sum256(append(append(append([]byte{}, pow...), char), nonce...))
+	hash = sha256.Sum256(hash[:])
+	return hash[:]
+}
+
+func TestValidateClaim(t *testing.T) {
+	for _, nonce := range []string{claimNonce, claimShortNonce} {
+		tx, o := buildClaim(t, []byte{0x00}, 'a', nonce, nil)
+		if err := ValidateClaim(tx, 0, o); err != nil {
+			t.Errorf("nonce %s: %v", nonce, err)
+		}
+	}
+}
+
+func TestValidateClaimRejects(t *testing.T) {
+	otherOwner, _ := script.NewFromHex("76a914ffffffffffffffffffffffffffffffffffffffff88ac")
+	claimedA := (&Opns{Claimed: []byte{0x00}}).Claim('a')
+	claimedB := (&Opns{Claimed: []byte{0x00}}).Claim('b')
+	tests := []struct {
+		name    string
+		claimed []byte
+		nonce   string
+		edit    func(tx *transaction.Transaction, hash []byte)
+		unlock  func(tx *transaction.Transaction)
+		want    string
+	}{{
+		name: "missing outputs",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs = tx.Outputs[:2]
+		},
+		want: "at least 3 outputs",
+	}, {
+		name: "malformed unlock",
+		unlock: func(tx *transaction.Transaction) {
+			unlock := &script.Script{}
+			unlock.AppendPushData([]byte("ab"))
+			unlock.AppendPushData([]byte{0x00})
+			unlock.AppendPushData(*claimOwner)
+			tx.Inputs[0].UnlockingScript = unlock
+		},
+		want: "malformed unlocking script",
+	}, {
+		name:    "char already claimed",
+		claimed: claimedA,
+		want:    "already claimed",
+	}, {
+		name:  "bad proof of work",
+		nonce: "c2767a0000000000000000000000000000000000000000000000000000000000",
+		want:  "does not meet difficulty",
+	}, {
+		name: "output not 1 sat",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[1].Satoshis = 2
+		},
+		want: "output 1 must be 1 sat",
+	}, {
+		name: "restate not a contract",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[0].LockingScript = claimOwner
+		},
+		want: "output 0 is not an OpNS contract",
+	}, {
+		name: "restate changes domain",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[0].LockingScript = Lock(claimedA, "b", hash)
+		},
+		want: "output 0 changes the domain",
+	}, {
+		name: "wrong claimed bitmap",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[0].LockingScript = Lock(claimedB, "", hash)
+		},
+		want: "output 0 claimed bitmap does not add char",
+	}, {
+		name: "restate keeps parent pow",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[0].LockingScript = Lock(claimedA, "", claimPow)
+		},
+		want: "output 0 pow does not match",
+	}, {
+		name: "mint not a contract",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[1].LockingScript = claimOwner
+		},
+		want: "output 1 is not an OpNS contract",
+	}, {
+		name: "wrong domain extension",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[1].LockingScript = Lock([]byte{0x00}, "b", hash)
+		},
+		want: `output 1 domain "b" does not extend`,
+	}, {
+		name: "mint already claimed",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[1].LockingScript = Lock(claimedB, "a", hash)
+		},
+		want: "output 1 must start with nothing claimed",
+	}, {
+		name: "mint keeps parent pow",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[1].LockingScript = Lock([]byte{0x00}, "a", claimPow)
+		},
+		want: "output 1 pow does not match",
+	}, {
+		name: "mismatched inscription",
+		edit: func(tx *transaction.Transaction, hash []byte) {
+			tx.Outputs[2].LockingScript = DefaultRoot.BuildInscription("a", otherOwner)
+		},
+		want: "output 2 inscription does not match",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimed, nonce := tt.claimed, tt.nonce
+			if claimed == nil {
+				claimed = []byte{0x00}
+			}
+			if nonce == "" {
+				nonce = claimNonce
+			}
+			tx, o := buildClaim(t, claimed, 'a', nonce, tt.edit)
+			if tt.unlock != nil {
+				tt.unlock(tx)
+			}
+			// The contract refuses most of these too, so the checks made in
+			// Go are run on their own to prove each one fires.
+			if err := checkClaim(tx, 0, o); err == nil {
+				t.Fatal("claim was accepted")
+			} else if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %q, want %q", err, tt.want)
+			}
+			if err := ValidateClaim(tx, 0, o); err == nil {
+				t.Fatal("ValidateClaim accepted the claim")
+			}
+		})
+	}
+}
+
+func TestValidateClaimScript(t *testing.T) {
+	tx, o := buildClaim(t, []byte{0x00}, 'a', claimNonce, nil)
+	// Outputs changed after the unlock is built break its preimage.
+	tx.Outputs[2].Satoshis = 2
+	if err := ValidateClaim(tx, 0, o); err == nil || !strings.HasPrefix(err.Error(), "script execution failed") {
+		t.Errorf("got %v, want a script failure", err)
+	}
+}
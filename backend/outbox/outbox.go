@@ -0,0 +1,313 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsv-blockchain/go-sdk/util"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+// PeersKey is the set of peers with queued deliveries.
+var PeersKey = "outbox:peers"
+
+// QueueKey is a peer's deliveries, "<txid>:<topic>", scored by when each is
+// next due in Unix milliseconds.
+func QueueKey(peer string) string {
+	return "outbox:q:" + peer
+}
+
+// AttemptsKey counts failed attempts of a peer's queued deliveries.
+func AttemptsKey(peer string) string {
+	return "outbox:att:" + peer
+}
+
+// DeadKey holds the deliveries to a peer that were given up on, scored by
+// when.
+func DeadKey(peer string) string {
+	return "outbox:dead:" + peer
+}
+
+// StatsKey holds a peer's delivery counters.
+func StatsKey(peer string) string {
+	return "outbox:stats:" + peer
+}
+
+// BeefKey holds the BEEF of a queued transaction until it expires.
+func BeefKey(txid string) string {
+	return "outbox:beef:" + txid
+}
+
+// Outbox delivers admitted transactions to peer overlays in the background.
+// Deliveries are queued in Redis, so they survive restarts, and each peer is
+// worked in order by its own worker, retrying failures with backoff until
+// the attempts run out. Deliveries the peer refuses outright are dropped.
+type Outbox struct {
+	Redis *redis.Client
+	// Timeout bounds each delivery.
+	Timeout time.Duration
+	Backoff ingest.Backoff
+	// PollInterval is how often idle queues and new peers are checked.
+	PollInterval time.Duration
+	// BeefTTL is how long a queued BEEF is kept; it should outlast the
+	// retries.
+	BeefTTL time.Duration
+
+	client *http.Client
+	wake   chan struct{}
+}
+
+func New(rdb *redis.Client) *Outbox {
+	return &Outbox{
+		Redis:   rdb,
+		Timeout: 30 * time.Second,
+		Backoff: ingest.Backoff{
+			Attempts: 12,
+			Initial:  5 * time.Second,
+			Max:      time.Hour,
+		},
+		PollInterval: 5 * time.Second,
+		BeefTTL:      7 * 24 * time.Hour,
+		client:       &http.Client{},
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// PeerStats reports deliveries to one peer.
+type PeerStats struct {
+	Peer        string `json:"peer"`
+	Pending     int64  `json:"pending"`
+	Dead        int64  `json:"dead"`
+	Sent        int64  `json:"sent"`
+	Failed      int64  `json:"failed"`
+	Dropped     int64  `json:"dropped"`
+	LastSent    int64  `json:"lastSent,omitempty"`
+	LastError   string `json:"lastError,omitempty"`
+	LastErrorAt int64  `json:"lastErrorAt,omitempty"`
+}
+
+// Enqueue queues txid for delivery to peer under topic.
+func (o *Outbox) Enqueue(ctx context.Context, peer, topic, txid string, beef []byte) error {
+	if _, err := o.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, BeefKey(txid), beef, o.BeefTTL)
+		p.ZAddNX(ctx, QueueKey(peer), redis.Z{
+			Member: txid + ":" + topic,
+			Score:  float64(time.Now().UnixMilli()),
+		})
+		p.SAdd(ctx, PeersKey, peer)
+		return nil
+	}); err != nil {
+		return err
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run starts a worker for every peer with queued deliveries, and for each
+// new one as it appears, until ctx is done.
+func (o *Outbox) Run(ctx context.Context) error {
+	workers := make(map[string]bool)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		if peers, err := o.Redis.SMembers(ctx, PeersKey).Result(); err != nil && ctx.Err() == nil {
+			log.Printf("Error listing outbox peers: %v", err)
+		} else {
+			for _, peer := range peers {
+				if !workers[peer] {
+					workers[peer] = true
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						o.work(ctx, peer)
+					}()
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-o.wake:
+		case <-time.After(o.PollInterval):
+		}
+	}
+}
+
+func (o *Outbox) work(ctx context.Context, peer string) {
+	for ctx.Err() == nil {
+		due, err := o.Redis.ZRangeArgs(ctx, redis.ZRangeArgs{
+			Key:     QueueKey(peer),
+			Start:   "-inf",
+			Stop:    time.Now().UnixMilli(),
+			ByScore: true,
+			Count:   100,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error reading outbox for %s: %v", peer, err)
+		}
+		for i := 0; i < len(due) && ctx.Err() == nil; i++ {
+			if err := o.deliver(ctx, peer, due[i]); err != nil && ctx.Err() == nil {
+				log.Printf("Error delivering %s to %s: %v", due[i], peer, err)
+			}
+		}
+		if len(due) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(o.PollInterval):
+			}
+		}
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, peer, member string) error {
+	txid, top, ok := strings.Cut(member, ":")
+	if !ok {
+		return o.Redis.ZRem(ctx, QueueKey(peer), member).Err()
+	}
+	beef, err := o.Redis.Get(ctx, BeefKey(txid)).Bytes()
+	if err == redis.Nil {
+		return o.finish(ctx, peer, member, "dropped", fmt.Errorf("BEEF for %s has expired", txid))
+	} else if err != nil {
+		return err
+	}
+
+	if err := o.send(ctx, peer, top, beef); err == nil {
+		return o.finish(ctx, peer, member, "sent", nil)
+	} else if ctx.Err() != nil {
+		// Shutting down is not the peer's failure.
+		return ctx.Err()
+	} else if permanent(err) {
+		return o.finish(ctx, peer, member, "dropped", err)
+	} else if attempts, aErr := o.Redis.HIncrBy(ctx, AttemptsKey(peer), member, 1).Result(); aErr != nil {
+		return aErr
+	} else if int(attempts) >= o.Backoff.Attempts {
+		return o.finish(ctx, peer, member, "dropped", err)
+	} else {
+		delay := o.Backoff.Initial << (attempts - 1)
+		if delay <= 0 || delay > o.Backoff.Max {
+			delay = o.Backoff.Max
+		}
+		_, pErr := o.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.ZAddXX(ctx, QueueKey(peer), redis.Z{
+				Member: member,
+				Score:  float64(time.Now().Add(delay).UnixMilli()),
+			})
+			p.HIncrBy(ctx, StatsKey(peer), "failed", 1)
+			p.HSet(ctx, StatsKey(peer), "lastError", err.Error(), "lastErrorAt", time.Now().Unix())
+			return nil
+		})
+		if pErr != nil {
+			return pErr
+		}
+		return fmt.Errorf("attempt %d: %w", attempts, err)
+	}
+}
+
+// send posts beef to the peer's /submit, as the SDK's broadcast facilitator
+// does, but bounded by ctx so shutdown does not wait on a slow peer. A
+// response other than 200 is a *util.HTTPError.
+func (o *Outbox) send(ctx context.Context, peer, top string, beef []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+	topics, err := json.Marshal([]string{top})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+"/submit", bytes.NewReader(beef))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Topics", string(topics))
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &util.HTTPError{
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("submit: %s", bytes.TrimSpace(body)),
+		}
+	}
+	return nil
+}
+
+// permanent reports whether the peer refused the delivery in a way that
+// retrying cannot change: a 4xx other than a timeout or rate limit.
+func permanent(err error) bool {
+	var httpErr *util.HTTPError
+	return errors.As(err, &httpErr) &&
+		httpErr.StatusCode >= 400 && httpErr.StatusCode < 500 &&
+		httpErr.StatusCode != http.StatusRequestTimeout &&
+		httpErr.StatusCode != http.StatusTooManyRequests
+}
+
+// finish takes a delivery off the queue as sent or dropped. Dropped
+// deliveries are kept in the peer's dead set.
+func (o *Outbox) finish(ctx context.Context, peer, member, outcome string, cause error) error {
+	now := time.Now()
+	if _, err := o.Redis.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, QueueKey(peer), member)
+		p.HDel(ctx, AttemptsKey(peer), member)
+		p.HIncrBy(ctx, StatsKey(peer), outcome, 1)
+		if cause != nil {
+			p.ZAdd(ctx, DeadKey(peer), redis.Z{Member: member, Score: float64(now.Unix())})
+			p.HSet(ctx, StatsKey(peer), "lastError", cause.Error(), "lastErrorAt", now.Unix())
+		} else {
+			p.HSet(ctx, StatsKey(peer), "lastSent", now.Unix())
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if cause != nil {
+		log.Printf("Gave up delivering %s to %s: %v", member, peer, cause)
+	}
+	return nil
+}
+
+// Stats reports deliveries to every peer with queued or past deliveries.
+func (o *Outbox) Stats(ctx context.Context) ([]*PeerStats, error) {
+	peers, err := o.Redis.SMembers(ctx, PeersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]*PeerStats, 0, len(peers))
+	for _, peer := range peers {
+		var pending, dead *redis.IntCmd
+		var all *redis.MapStringStringCmd
+		if _, err := o.Redis.Pipelined(ctx, func(p redis.Pipeliner) error {
+			pending = p.ZCard(ctx, QueueKey(peer))
+			dead = p.ZCard(ctx, DeadKey(peer))
+			all = p.HGetAll(ctx, StatsKey(peer))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		s := &PeerStats{Peer: peer, Pending: pending.Val(), Dead: dead.Val()}
+		counters := all.Val()
+		fmt.Sscan(counters["sent"], &s.Sent)
+		fmt.Sscan(counters["failed"], &s.Failed)
+		fmt.Sscan(counters["dropped"], &s.Dropped)
+		fmt.Sscan(counters["lastSent"], &s.LastSent)
+		fmt.Sscan(counters["lastErrorAt"], &s.LastErrorAt)
+		s.LastError = counters["lastError"]
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
@@ -0,0 +1,249 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	"github.com/redis/go-redis/v9"
+)
+
+// peer is an overlay answering /submit with the statuses in replies, then
+// 200 once they run out.
+type peer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	replies  []int
+	received []string
+}
+
+func newPeer(t *testing.T, replies ...int) *peer {
+	p := &peer{replies: replies}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.received = append(p.received, r.URL.Path+" "+r.Header.Get("X-Topics")+" "+string(body))
+		if len(p.replies) > 0 {
+			status := p.replies[0]
+			p.replies = p.replies[1:]
+			w.WriteHeader(status)
+			w.Write([]byte(`{"code":"test"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *peer) requests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.received...)
+}
+
+func newOutbox(t *testing.T) (*Outbox, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	o := New(rdb)
+	o.Backoff = ingest.Backoff{Attempts: 3, Initial: time.Minute, Max: time.Hour}
+	o.PollInterval = 10 * time.Millisecond
+	return o, mr
+}
+
+func peerStats(t *testing.T, o *Outbox, url string) *PeerStats {
+	t.Helper()
+	stats, err := o.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range stats {
+		if s.Peer == url {
+			return s
+		}
+	}
+	t.Fatalf("no stats for %s in %v", url, stats)
+	return nil
+}
+
+func TestOutboxDelivers(t *testing.T) {
+	o, _ := newOutbox(t)
+	p := newPeer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- o.Run(ctx) }()
+
+	if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for peerStats(t, o, p.URL).Sent == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("delivery was not sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := p.requests(); len(got) != 1 || got[0] != `/submit ["tm_OpNS"] beef` {
+		t.Errorf("peer received %q", got)
+	}
+	if s := peerStats(t, o, p.URL); s.Pending != 0 || s.Failed != 0 || s.Dropped != 0 || s.LastSent == 0 {
+		t.Errorf("stats %+v, want one sent", s)
+	}
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	o, _ := newOutbox(t)
+	p := newPeer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	ctx := context.Background()
+	if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	member := "aa:tm_OpNS"
+	for attempt, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		start := time.Now()
+		if err := o.deliver(ctx, p.URL, member); err == nil {
+			t.Fatalf("attempt %d: delivered, want a failure", attempt+1)
+		}
+		if due, err := o.Redis.ZScore(ctx, QueueKey(p.URL), member).Result(); err != nil {
+			t.Fatal(err)
+		} else if delay := time.UnixMilli(int64(due)).Sub(start); delay < wantDelay-time.Second || delay > wantDelay+time.Second {
+			t.Errorf("attempt %d: retried after %s, want %s", attempt+1, delay, wantDelay)
+		}
+	}
+	if s := peerStats(t, o, p.URL); s.Failed != 2 || s.Pending != 1 || s.LastError == "" {
+		t.Errorf("stats %+v, want two failures and one pending", s)
+	}
+	if err := o.deliver(ctx, p.URL, member); err != nil {
+		t.Fatal(err)
+	}
+	if s := peerStats(t, o, p.URL); s.Sent != 1 || s.Pending != 0 || s.Dead != 0 {
+		t.Errorf("stats %+v, want sent after retries", s)
+	}
+	if n, err := o.Redis.HLen(ctx, AttemptsKey(p.URL)).Result(); err != nil || n != 0 {
+		t.Errorf("%d attempt counters left, %v", n, err)
+	}
+}
+
+func TestOutboxDropsAfterAttempts(t *testing.T) {
+	o, _ := newOutbox(t)
+	p := newPeer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	ctx := context.Background()
+	if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	for range o.Backoff.Attempts {
+		o.deliver(ctx, p.URL, "aa:tm_OpNS")
+	}
+	if s := peerStats(t, o, p.URL); s.Failed != 2 || s.Dropped != 1 || s.Pending != 0 || s.Dead != 1 {
+		t.Errorf("stats %+v, want dropped after %d attempts", s, o.Backoff.Attempts)
+	}
+}
+
+func TestOutboxDropsRefused(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity} {
+		o, _ := newOutbox(t)
+		p := newPeer(t, status)
+		ctx := context.Background()
+		if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+			t.Fatal(err)
+		} else if err := o.deliver(ctx, p.URL, "aa:tm_OpNS"); err != nil {
+			t.Fatal(err)
+		}
+		if s := peerStats(t, o, p.URL); s.Failed != 0 || s.Dropped != 1 || s.Dead != 1 {
+			t.Errorf("%d: stats %+v, want dropped at once", status, s)
+		}
+	}
+	for _, status := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError} {
+		o, _ := newOutbox(t)
+		p := newPeer(t, status)
+		ctx := context.Background()
+		if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+			t.Fatal(err)
+		}
+		o.deliver(ctx, p.URL, "aa:tm_OpNS")
+		if s := peerStats(t, o, p.URL); s.Failed != 1 || s.Dropped != 0 || s.Pending != 1 {
+			t.Errorf("%d: stats %+v, want a retry", status, s)
+		}
+	}
+}
+
+func TestOutboxExpiredBeef(t *testing.T) {
+	o, mr := newOutbox(t)
+	p := newPeer(t)
+	ctx := context.Background()
+	if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(o.BeefTTL + time.Second)
+	if err := o.deliver(ctx, p.URL, "aa:tm_OpNS"); err != nil {
+		t.Fatal(err)
+	}
+	if s := peerStats(t, o, p.URL); s.Dropped != 1 || len(p.requests()) != 0 {
+		t.Errorf("stats %+v, want dropped without sending", s)
+	}
+}
+
+// TestOutboxSurvivesRestart queues with one Outbox and delivers with
+// another on the same Redis.
+func TestOutboxSurvivesRestart(t *testing.T) {
+	first, _ := newOutbox(t)
+	p := newPeer(t)
+	if err := first.Enqueue(context.Background(), p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	second := New(first.Redis)
+	second.PollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go second.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.requests()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued delivery was not sent after restart")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestOutboxShutdown stops while a peer is holding a delivery open.
+func TestOutboxShutdown(t *testing.T) {
+	o, _ := newOutbox(t)
+	o.Timeout = time.Minute
+	held := make(chan struct{})
+	p := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The body is read so the server notices the client going away.
+		io.ReadAll(r.Body)
+		close(held)
+		<-r.Context().Done()
+	}))
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := o.Enqueue(ctx, p.URL, "tm_OpNS", "aa", []byte("beef")); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- o.Run(ctx) }()
+	<-held
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run waited on the held delivery")
+	}
+	if s := peerStats(t, o, p.URL); s.Failed != 0 || s.Pending != 1 {
+		t.Errorf("stats %+v, want the delivery still pending", s)
+	}
+}
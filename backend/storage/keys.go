@@ -12,7 +12,7 @@ func outputKey(outpoint *overlay.Outpoint) string {
 
 var BeefKey = "beef"
 
-func outMembershipKey(topic string) string {
+func OutMembershipKey(topic string) string {
 	return "om:" + topic
 }
 
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	"github.com/4chain-ag/go-overlay-services/pkg/core/engine"
@@ -32,7 +33,7 @@ func (s *RedisStorage) InsertOutput(ctx context.Context, utxo *engine.Output) (e
 			return err
 		} else if err = p.HSet(ctx, BeefKey, utxo.Outpoint.Txid.String(), utxo.Beef).Err(); err != nil {
 			return err
-		} else if err = p.ZAdd(ctx, outMembershipKey(utxo.Topic), redis.Z{
+		} else if err = p.ZAdd(ctx, OutMembershipKey(utxo.Topic), redis.Z{
 			Score:  float64(utxo.BlockHeight)*1e9 + float64(utxo.BlockIdx),
 			Member: utxo.Outpoint.String(),
 		}).Err(); err != nil {
@@ -114,13 +115,30 @@ func (s *RedisStorage) FindOutputsForTransaction(ctx context.Context, txid *chai
 	return outputs, nil
 }
 
+// FindUTXOsForTopic returns the topic's outputs mined at or after block
+// since, along with every unmined output.
 func (s *RedisStorage) FindUTXOsForTopic(ctx context.Context, topic string, since uint32, includeBEEF bool) ([]*engine.Output, error) {
-	if outpoints, err := s.DB.ZRangeByScore(ctx, outMembershipKey(topic), &redis.ZRangeBy{
-		Min: "0",
+	var outpoints []string
+	min := "0"
+	if since > 0 {
+		// Unmined outputs score below the first block.
+		if unmined, err := s.DB.ZRangeByScore(ctx, OutMembershipKey(topic), &redis.ZRangeBy{
+			Min: "0",
+			Max: "(1e9",
+		}).Result(); err != nil {
+			return nil, err
+		} else {
+			outpoints = unmined
+		}
+		min = strconv.FormatUint(uint64(since)*1e9, 10)
+	}
+	if mined, err := s.DB.ZRangeByScore(ctx, OutMembershipKey(topic), &redis.ZRangeBy{
+		Min: min,
 		Max: "inf",
 	}).Result(); err != nil {
 		return nil, err
 	} else {
+		outpoints = append(outpoints, mined...)
 		outputs := make([]*engine.Output, 0, len(outpoints))
 		for _, outpointStr := range outpoints {
 			if outpoint, err := overlay.NewOutpointFromString(outpointStr); err != nil {
@@ -139,7 +157,7 @@ func (s *RedisStorage) DeleteOutput(ctx context.Context, outpoint *overlay.Outpo
 	_, err := s.DB.Pipelined(ctx, func(p redis.Pipeliner) error {
 		if err := p.Del(ctx, OutputTopicKey(outpoint, topic)).Err(); err != nil {
 			return err
-		} else if p.ZRem(ctx, outMembershipKey(topic), outpoint.String()).Err(); err != nil {
+		} else if p.ZRem(ctx, OutMembershipKey(topic), outpoint.String()).Err(); err != nil {
 			return err
 		}
 		iter := p.Scan(ctx, 0, "ot:"+outpoint.String()+":*", 0).Iterator()
@@ -168,6 +186,12 @@ func (s *RedisStorage) MarkUTXOAsSpent(ctx context.Context, outpoint *overlay.Ou
 	return s.DB.HSet(ctx, OutputTopicKey(outpoint, topic), "sp", true).Err()
 }
 
+// MarkUTXOAsUnspent reverses MarkUTXOAsSpent, for a spend orphaned by a
+// reorg.
+func (s *RedisStorage) MarkUTXOAsUnspent(ctx context.Context, outpoint *overlay.Outpoint, topic string) error {
+	return s.DB.HSet(ctx, OutputTopicKey(outpoint, topic), "sp", false).Err()
+}
+
 func (s *RedisStorage) MarkUTXOsAsSpent(ctx context.Context, outpoints []*overlay.Outpoint, topic string) error {
 	for _, outpoint := range outpoints {
 		if err := s.MarkUTXOAsSpent(ctx, outpoint, topic); err != nil {
@@ -182,11 +206,22 @@ func (s *RedisStorage) UpdateConsumedBy(ctx context.Context, outpoint *overlay.O
 }
 
 func (s *RedisStorage) UpdateTransactionBEEF(ctx context.Context, txid *chainhash.Hash, beef []byte) error {
-	return s.DB.HSetNX(ctx, BeefKey, txid.String(), beef).Err()
+	return s.DB.HSet(ctx, BeefKey, txid.String(), beef).Err()
 }
 
 func (s *RedisStorage) UpdateOutputBlockHeight(ctx context.Context, outpoint *overlay.Outpoint, topic string, blockHeight uint32, blockIndex uint64, ancelliaryBeef []byte) error {
-	return s.DB.HSet(ctx, OutputTopicKey(outpoint, topic), "h", blockHeight, "i", blockIndex, "ab", ancelliaryBeef).Err()
+	_, err := s.DB.Pipelined(ctx, func(p redis.Pipeliner) error {
+		if err := p.HSet(ctx, OutputTopicKey(outpoint, topic), "h", blockHeight, "i", blockIndex, "ab", ancelliaryBeef).Err(); err != nil {
+			return err
+		} else if err := p.HSet(ctx, outputKey(outpoint), "h", blockHeight, "i", blockIndex).Err(); err != nil {
+			return err
+		}
+		return p.ZAddXX(ctx, OutMembershipKey(topic), redis.Z{
+			Score:  float64(blockHeight)*1e9 + float64(blockIndex),
+			Member: outpoint.String(),
+		}).Err()
+	})
+	return err
 }
 
 func (s *RedisStorage) InsertAppliedTransaction(ctx context.Context, tx *overlay.AppliedTransaction) error {
@@ -0,0 +1,72 @@
+package txstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+)
+
+// FS keeps each transaction and merkle path in its own file, in the layout
+// read by ingest.File, so a store directory can be replayed offline as a
+// "file:" source.
+type FS struct {
+	Dir string
+}
+
+func NewFS(dir string) (*FS, error) {
+	for _, sub := range []string{"tx", "proof"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FS{Dir: dir}, nil
+}
+
+func (f *FS) read(kind string, txid *chainhash.Hash) ([]byte, error) {
+	if data, err := os.ReadFile(filepath.Join(f.Dir, kind, txid.String())); os.IsNotExist(err) {
+		return nil, ingest.ErrNotFound
+	} else {
+		return data, err
+	}
+}
+
+// write stores data under a temporary name first so a reader never sees a
+// partial file.
+func (f *FS) write(kind string, txid *chainhash.Hash, data []byte) error {
+	dir := filepath.Join(f.Dir, kind)
+	if tmp, err := os.CreateTemp(dir, ".tmp-*"); err != nil {
+		return err
+	} else if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	} else if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	} else {
+		return os.Rename(tmp.Name(), filepath.Join(dir, txid.String()))
+	}
+}
+
+func (f *FS) GetTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	return f.read("tx", txid)
+}
+
+func (f *FS) PutTx(ctx context.Context, txid *chainhash.Hash, rawtx []byte) error {
+	return f.write("tx", txid, rawtx)
+}
+
+func (f *FS) GetProof(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	return f.read("proof", txid)
+}
+
+func (f *FS) PutProof(ctx context.Context, txid *chainhash.Hash, bump []byte) error {
+	return f.write("proof", txid, bump)
+}
+
+func (f *FS) Close() error {
+	return nil
+}
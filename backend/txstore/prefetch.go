@@ -0,0 +1,63 @@
+package txstore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+)
+
+// Prefetch stores txids, their merkle paths and the parents they spend,
+// everything ingest.BuildBeef needs for a mined parent, using workers
+// concurrent fetches with backoff. Failures are passed to onError and do not
+// stop the rest. It returns the number of transactions fetched.
+func (s *Store) Prefetch(ctx context.Context, txids []*chainhash.Hash, workers int, backoff ingest.Backoff, onError func(txid *chainhash.Hash, attempts int, err error)) int {
+	var seen sync.Map
+	var mu sync.Mutex
+	fetched := 0
+	fetch := func(txid *chainhash.Hash) *transaction.Transaction {
+		if _, loaded := seen.LoadOrStore(*txid, struct{}{}); loaded {
+			return nil
+		}
+		var tx *transaction.Transaction
+		if attempts, err := backoff.Retry(ctx, func() (err error) {
+			tx, err = ingest.LoadTx(ctx, s, txid)
+			return err
+		}); err != nil {
+			seen.Delete(*txid)
+			onError(txid, attempts, err)
+			return nil
+		}
+		mu.Lock()
+		fetched++
+		mu.Unlock()
+		return tx
+	}
+
+	jobs := make(chan *chainhash.Hash)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for txid := range jobs {
+				if tx := fetch(txid); tx != nil {
+					for _, input := range tx.Inputs {
+						fetch(input.SourceTXID)
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < len(txids) && ctx.Err() == nil; i++ {
+		select {
+		case <-ctx.Done():
+		case jobs <- txids[i]:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return fetched
+}
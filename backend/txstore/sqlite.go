@@ -0,0 +1,66 @@
+package txstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLite keeps transactions and merkle paths in a single database file.
+type SQLite struct {
+	DB *sql.DB
+}
+
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS txns (
+		txid BLOB PRIMARY KEY,
+		rawtx BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS proofs (
+		txid BLOB PRIMARY KEY,
+		bump BLOB NOT NULL
+	);`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{DB: db}, nil
+}
+
+func (s *SQLite) get(ctx context.Context, query string, txid *chainhash.Hash) ([]byte, error) {
+	var data []byte
+	if err := s.DB.QueryRowContext(ctx, query, txid[:]).Scan(&data); err == sql.ErrNoRows {
+		return nil, ingest.ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *SQLite) GetTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	return s.get(ctx, "SELECT rawtx FROM txns WHERE txid = ?", txid)
+}
+
+func (s *SQLite) PutTx(ctx context.Context, txid *chainhash.Hash, rawtx []byte) error {
+	_, err := s.DB.ExecContext(ctx, "INSERT OR IGNORE INTO txns (txid, rawtx) VALUES (?, ?)", txid[:], rawtx)
+	return err
+}
+
+func (s *SQLite) GetProof(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	return s.get(ctx, "SELECT bump FROM proofs WHERE txid = ?", txid)
+}
+
+func (s *SQLite) PutProof(ctx context.Context, txid *chainhash.Hash, bump []byte) error {
+	_, err := s.DB.ExecContext(ctx, "INSERT OR REPLACE INTO proofs (txid, bump) VALUES (?, ?)", txid[:], bump)
+	return err
+}
+
+func (s *SQLite) Close() error {
+	return s.DB.Close()
+}
@@ -0,0 +1,118 @@
+package txstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+)
+
+// DefaultSpec is used when no store is configured.
+var DefaultSpec = "fs:txstore"
+
+var ErrOffline = errors.New("no remote source")
+
+// Backend holds raw transactions and merkle paths keyed by txid. Gets of a
+// missing entry return ingest.ErrNotFound.
+type Backend interface {
+	GetTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error)
+	PutTx(ctx context.Context, txid *chainhash.Hash, rawtx []byte) error
+	GetProof(ctx context.Context, txid *chainhash.Hash) ([]byte, error)
+	PutProof(ctx context.Context, txid *chainhash.Hash, bump []byte) error
+	Close() error
+}
+
+// Store is a local transaction store that reads through to Remote on a
+// miss. It is itself an ingest.Source, so any tool can use it in place of a
+// remote. With no Remote it serves only what has already been stored.
+type Store struct {
+	Backend Backend
+	Remote  ingest.Source
+}
+
+// Open builds a store from a spec of the form "fs:<dir>" or
+// "sqlite:<path>". An empty spec means DefaultSpec.
+func Open(spec string, remote ingest.Source) (*Store, error) {
+	if spec == "" {
+		spec = DefaultSpec
+	}
+	kind, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid store %q", spec)
+	}
+	var backend Backend
+	var err error
+	switch kind {
+	case "fs":
+		backend, err = NewFS(target)
+	case "sqlite":
+		backend, err = NewSQLite(target)
+	default:
+		return nil, fmt.Errorf("unknown store type %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Backend: backend, Remote: remote}, nil
+}
+
+// RawTx returns the stored transaction, fetching and storing it on a miss.
+// Fetched bytes must hash to txid.
+func (s *Store) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	if rawtx, err := s.Backend.GetTx(ctx, txid); err != ingest.ErrNotFound {
+		return rawtx, err
+	} else if s.Remote == nil {
+		return nil, ingest.ErrNotFound
+	} else if rawtx, err := s.Remote.RawTx(ctx, txid); err != nil {
+		return nil, err
+	} else if hash := chainhash.DoubleHashH(rawtx); !bytes.Equal(hash[:], txid[:]) {
+		return nil, fmt.Errorf("%s: remote returned transaction %s", txid, hash)
+	} else if err := s.Backend.PutTx(ctx, txid, rawtx); err != nil {
+		return nil, err
+	} else {
+		return rawtx, nil
+	}
+}
+
+// Proof returns the stored merkle path, fetching and storing it on a miss.
+// Unmined transactions are asked of the remote every time.
+func (s *Store) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	if bump, err := s.Backend.GetProof(ctx, txid); err == nil {
+		return transaction.NewMerklePathFromBinary(bump)
+	} else if err != ingest.ErrNotFound {
+		return nil, err
+	} else if s.Remote == nil {
+		return nil, nil
+	} else if proof, err := s.Remote.Proof(ctx, txid); err != nil || proof == nil {
+		return nil, err
+	} else if err := s.Backend.PutProof(ctx, txid, proof.Bytes()); err != nil {
+		return nil, err
+	} else {
+		return proof, nil
+	}
+}
+
+// Spend is never stored, since an unspent output can be spent at any time.
+func (s *Store) Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error) {
+	if s.Remote == nil {
+		return nil, ErrOffline
+	}
+	return s.Remote.Spend(ctx, outpoint)
+}
+
+func (s *Store) Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *ingest.Handler) error {
+	if s.Remote == nil {
+		return ErrOffline
+	}
+	return s.Remote.Subscribe(ctx, subscription, fromBlock, handler)
+}
+
+func (s *Store) Close() error {
+	return s.Backend.Close()
+}
@@ -0,0 +1,206 @@
+package txstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bsv-blockchain/go-sdk/chainhash"
+	"github.com/bsv-blockchain/go-sdk/overlay"
+	"github.com/bsv-blockchain/go-sdk/script"
+	"github.com/bsv-blockchain/go-sdk/transaction"
+	"github.com/bsvhackathon/GorillaPool/backend/ingest"
+)
+
+// stubRemote serves fixed transactions and proofs, counting the fetches.
+type stubRemote struct {
+	txs                 map[chainhash.Hash][]byte
+	proofs              map[chainhash.Hash]*transaction.MerklePath
+	txCalls, proofCalls int
+}
+
+func (r *stubRemote) RawTx(ctx context.Context, txid *chainhash.Hash) ([]byte, error) {
+	r.txCalls++
+	if rawtx, ok := r.txs[*txid]; ok {
+		return rawtx, nil
+	}
+	return nil, ingest.ErrNotFound
+}
+
+func (r *stubRemote) Proof(ctx context.Context, txid *chainhash.Hash) (*transaction.MerklePath, error) {
+	r.proofCalls++
+	return r.proofs[*txid], nil
+}
+
+func (r *stubRemote) Spend(ctx context.Context, outpoint *overlay.Outpoint) (*chainhash.Hash, error) {
+	return nil, nil
+}
+
+func (r *stubRemote) Subscribe(ctx context.Context, subscription string, fromBlock uint32, handler *ingest.Handler) error {
+	return nil
+}
+
+func testTx(seed byte) *transaction.Transaction {
+	tx := transaction.NewTransaction()
+	tx.AddInput(&transaction.TransactionInput{
+		SourceTXID:       &chainhash.Hash{seed},
+		SourceTxOutIndex: 0,
+		UnlockingScript:  script.NewFromBytes([]byte{script.OpTRUE}),
+		SequenceNumber:   0xffffffff,
+	})
+	tx.AddOutput(&transaction.TransactionOutput{LockingScript: script.NewFromBytes([]byte{script.OpTRUE}), Satoshis: 1})
+	return tx
+}
+
+func testPath(txid *chainhash.Hash) *transaction.MerklePath {
+	isTxid := true
+	return transaction.NewMerklePath(100, [][]*transaction.PathElement{{
+		{Offset: 0, Hash: txid, Txid: &isTxid},
+		{Offset: 1, Hash: &chainhash.Hash{0xdd}},
+	}})
+}
+
+// backends opens each kind of backend in a fresh directory.
+func backends(t *testing.T) map[string]Backend {
+	t.Helper()
+	fs, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "txstore.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Backend{"fs": fs, "sqlite": db}
+}
+
+func TestStoreReadThrough(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			mined, pending := testTx(1), testTx(2)
+			remote := &stubRemote{
+				txs: map[chainhash.Hash][]byte{
+					*mined.TxID():   mined.Bytes(),
+					*pending.TxID(): pending.Bytes(),
+				},
+				proofs: map[chainhash.Hash]*transaction.MerklePath{
+					*mined.TxID(): testPath(mined.TxID()),
+				},
+			}
+			s := &Store{Backend: backend, Remote: remote}
+
+			for i := 0; i < 2; i++ {
+				if rawtx, err := s.RawTx(ctx, mined.TxID()); err != nil {
+					t.Fatal(err)
+				} else if !bytes.Equal(rawtx, mined.Bytes()) {
+					t.Errorf("read %d: raw tx does not match", i)
+				}
+				if proof, err := s.Proof(ctx, mined.TxID()); err != nil {
+					t.Fatal(err)
+				} else if proof == nil || !bytes.Equal(proof.Bytes(), remote.proofs[*mined.TxID()].Bytes()) {
+					t.Errorf("read %d: proof does not match", i)
+				}
+			}
+			if remote.txCalls != 1 || remote.proofCalls != 1 {
+				t.Errorf("remote fetched %d txs and %d proofs, want 1 of each", remote.txCalls, remote.proofCalls)
+			}
+
+			// An unmined transaction is asked for its proof every time.
+			for i := 0; i < 2; i++ {
+				if proof, err := s.Proof(ctx, pending.TxID()); err != nil || proof != nil {
+					t.Errorf("unmined proof: got %v, %v, want nil", proof, err)
+				}
+			}
+			if remote.proofCalls != 3 {
+				t.Errorf("remote fetched %d proofs, want 3", remote.proofCalls)
+			}
+
+			// What was stored is served without the remote.
+			offline := &Store{Backend: backend}
+			if rawtx, err := offline.RawTx(ctx, mined.TxID()); err != nil || !bytes.Equal(rawtx, mined.Bytes()) {
+				t.Errorf("offline raw tx: got %v", err)
+			}
+			if proof, err := offline.Proof(ctx, mined.TxID()); err != nil || proof == nil {
+				t.Errorf("offline proof: got %v, %v", proof, err)
+			}
+			if _, err := offline.RawTx(ctx, pending.TxID()); !errors.Is(err, ingest.ErrNotFound) {
+				t.Errorf("offline missing tx: got %v, want ErrNotFound", err)
+			}
+			if proof, err := offline.Proof(ctx, pending.TxID()); err != nil || proof != nil {
+				t.Errorf("offline missing proof: got %v, %v, want nil", proof, err)
+			}
+			if _, err := offline.Spend(ctx, &overlay.Outpoint{Txid: *mined.TxID()}); err != ErrOffline {
+				t.Errorf("offline spend: got %v, want ErrOffline", err)
+			}
+			if err := offline.Subscribe(ctx, "all", 0, &ingest.Handler{}); err != ErrOffline {
+				t.Errorf("offline subscribe: got %v, want ErrOffline", err)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsWrongTx(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			tx := testTx(1)
+			corrupted := tx.Bytes()
+			corrupted[len(corrupted)-1] ^= 0xff
+			s := &Store{Backend: backend, Remote: &stubRemote{
+				txs: map[chainhash.Hash][]byte{*tx.TxID(): corrupted},
+			}}
+
+			if _, err := s.RawTx(ctx, tx.TxID()); err == nil || !strings.Contains(err.Error(), "remote returned transaction") {
+				t.Errorf("got %v, want a txid mismatch", err)
+			}
+			if _, err := backend.GetTx(ctx, tx.TxID()); !errors.Is(err, ingest.ErrNotFound) {
+				t.Errorf("corrupted tx was stored: got %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFSLayout(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	backend, err := NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := testTx(1)
+	s := &Store{Backend: backend, Remote: &stubRemote{
+		txs:    map[chainhash.Hash][]byte{*tx.TxID(): tx.Bytes()},
+		proofs: map[chainhash.Hash]*transaction.MerklePath{*tx.TxID(): testPath(tx.TxID())},
+	}}
+	if _, err := ingest.LoadTx(ctx, s, tx.TxID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes are renamed into place, leaving no temporary files behind.
+	for _, sub := range []string{"tx", "proof"} {
+		entries, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != tx.TxID().String() {
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			t.Errorf("%s: got files %v, want only %s", sub, names, tx.TxID())
+		}
+	}
+
+	// The directory replays as a file source.
+	if loaded, err := ingest.LoadTx(ctx, ingest.NewFile(dir), tx.TxID()); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(loaded.Bytes(), tx.Bytes()) || loaded.MerklePath == nil {
+		t.Error("file source does not match the stored transaction")
+	}
+}